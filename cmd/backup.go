@@ -7,6 +7,8 @@ import (
 	"github.com/charmbracelet/log"
 	"github.com/slashtechno/gobackup-github/internal"
 	"github.com/slashtechno/gobackup-github/pkg/backup"
+	"github.com/slashtechno/gobackup-github/pkg/storage"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -19,26 +21,101 @@ var backupCmd = &cobra.Command{
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
 		err := backup.StartBackup(
-			backup.BackupConfig{
-				Usernames:         internal.Viper.GetStringSlice("usernames"),
-				InOrg:             internal.Viper.GetStringSlice("in-org"),
-				BackupStars:       internal.Viper.GetBool("stars"),
-				Token:             internal.Viper.GetString("token"),
-				Output:            internal.Viper.GetString("output"),
-				RunType:           internal.Viper.GetString("run-type"),
-				NtfyUrl:           internal.Viper.GetString("ntfy-url"),
-				RecurseSubmodules: internal.Viper.GetUint("recurse-submodules"),
-			},
-			// Pass an empty interval as this is a one-time backup
-			"",
+			backupConfigFromViper(),
+			// Pass an empty schedule as this is a one-time backup
+			backup.Schedule{},
 			0,
 		)
 		if err != nil {
-			log.Error("Backup failed", "err", err)
+			log.Fatal("Backup failed", "err", err)
 		}
 	},
 }
 
+// Build a BackupConfig from the flags, environment variables, and configuration file
+// Shared by `backup` and `backup continuous`
+func backupConfigFromViper() backup.BackupConfig {
+	return backup.BackupConfig{
+		Usernames:            internal.Viper.GetStringSlice("usernames"),
+		InOrg:                internal.Viper.GetStringSlice("in-org"),
+		Orgs:                 internal.Viper.GetStringSlice("orgs"),
+		BackupStars:          internal.Viper.GetBool("stars"),
+		Token:                internal.Viper.GetString("token"),
+		Output:               internal.Viper.GetString("output"),
+		RunType:              internal.Viper.GetString("run-type"),
+		NtfyUrl:              internal.Viper.GetString("ntfy-url"),
+		RecurseSubmodules:    internal.Viper.GetUint("recurse-submodules"),
+		Update:               internal.Viper.GetBool("update"),
+		CloneMode:            internal.Viper.GetString("clone-mode"),
+		BackupIssues:         internal.Viper.GetBool("backup-issues"),
+		BackupPullRequests:   internal.Viper.GetBool("backup-pull-requests"),
+		BackupWikis:          internal.Viper.GetBool("backup-wikis"),
+		BackupReleases:       internal.Viper.GetBool("backup-releases"),
+		ReleaseAssetsMaxSize: uint64(internal.Viper.GetSizeInBytes("release-assets-max-size")),
+		BackupGists:          internal.Viper.GetBool("backup-gists"),
+		BackupLFS:            internal.Viper.GetBool("backup-lfs"),
+		Concurrency:          internal.Viper.GetInt("concurrency"),
+		PerHostConcurrency:   internal.Viper.GetInt("per-host-concurrency"),
+		Deduplicate:          internal.Viper.GetBool("deduplicate"),
+		Archive:              internal.Viper.GetString("archive"),
+		ArchiveScope:         internal.Viper.GetString("archive-scope"),
+		// Named after the keys nested under `encryption` in the configuration file
+		EncryptionRecipients:     internal.Viper.GetStringSlice("encryption.recipients"),
+		EncryptionRecipientsFile: internal.Viper.GetString("encryption.recipients-file"),
+		Storage: storage.Config{
+			Type:      internal.Viper.GetString("storage.type"),
+			KeepLocal: internal.Viper.GetBool("storage.keep-local"),
+			S3: storage.S3Config{
+				Endpoint:        internal.Viper.GetString("storage.s3.endpoint"),
+				Bucket:          internal.Viper.GetString("storage.s3.bucket"),
+				Prefix:          internal.Viper.GetString("storage.s3.prefix"),
+				Region:          internal.Viper.GetString("storage.s3.region"),
+				AccessKeyID:     internal.Viper.GetString("storage.s3.access-key-id"),
+				SecretAccessKey: internal.Viper.GetString("storage.s3.secret-access-key"),
+				PathStyle:       internal.Viper.GetBool("storage.s3.path-style"),
+				Insecure:        internal.Viper.GetBool("storage.s3.insecure"),
+			},
+			SFTP: storage.SFTPConfig{
+				Host:           internal.Viper.GetString("storage.sftp.host"),
+				User:           internal.Viper.GetString("storage.sftp.user"),
+				Path:           internal.Viper.GetString("storage.sftp.path"),
+				KeyFile:        internal.Viper.GetString("storage.sftp.key-file"),
+				KeyPassphrase:  internal.Viper.GetString("storage.sftp.key-passphrase"),
+				KnownHostsFile: internal.Viper.GetString("storage.sftp.known-hosts-file"),
+			},
+		},
+		Retry: backup.RetryPolicy{
+			Attempts:       internal.Viper.GetInt("retry.attempts"),
+			InitialBackoff: internal.Viper.GetDuration("retry.initial-backoff"),
+			MaxBackoff:     internal.Viper.GetDuration("retry.max-backoff"),
+			Jitter:         internal.Viper.GetFloat64("retry.jitter"),
+		},
+		Filter: backup.RepositoryFilter{
+			Forks:            internal.Viper.GetString("filter.forks"),
+			Archived:         internal.Viper.GetString("filter.archived"),
+			Visibility:       internal.Viper.GetStringSlice("filter.visibility"),
+			Owners:           internal.Viper.GetStringSlice("filter.owners"),
+			ExcludeOwners:    internal.Viper.GetStringSlice("filter.exclude-owners"),
+			Topics:           internal.Viper.GetStringSlice("filter.topics"),
+			ExcludeTopics:    internal.Viper.GetStringSlice("filter.exclude-topics"),
+			Languages:        internal.Viper.GetStringSlice("filter.languages"),
+			ExcludeLanguages: internal.Viper.GetStringSlice("filter.exclude-languages"),
+			MinSize:          uint64(internal.Viper.GetSizeInBytes("filter.min-size")),
+			MaxSize:          uint64(internal.Viper.GetSizeInBytes("filter.max-size")),
+			Names:            internal.Viper.GetStringSlice("filter.names"),
+			ExcludeNames:     internal.Viper.GetStringSlice("filter.exclude-names"),
+		},
+		Retention: utils.RetentionPolicy{
+			KeepHourly:  internal.Viper.GetInt("retention.keep-hourly"),
+			KeepDaily:   internal.Viper.GetInt("retention.keep-daily"),
+			KeepWeekly:  internal.Viper.GetInt("retention.keep-weekly"),
+			KeepMonthly: internal.Viper.GetInt("retention.keep-monthly"),
+			KeepYearly:  internal.Viper.GetInt("retention.keep-yearly"),
+			KeepWithin:  internal.Viper.GetDuration("retention.keep-within"),
+		},
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(backupCmd)
 
@@ -57,13 +134,10 @@ func init() {
 	internal.Viper.BindPFlag("in-org", backupCmd.PersistentFlags().Lookup("in-org"))
 	internal.Viper.SetDefault("in-org", []string{})
 
-	backupCmd.PersistentFlags().StringP("token", "t", "", "GitHub token")
-	internal.Viper.BindPFlag("token", backupCmd.PersistentFlags().Lookup("token"))
-	internal.Viper.SetDefault("token", "")
-
-	backupCmd.PersistentFlags().StringP("output", "o", "", "Output directory")
-	internal.Viper.BindPFlag("output", backupCmd.PersistentFlags().Lookup("output"))
-	internal.Viper.SetDefault("output", "backup")
+	// Back up the repositories owned by an organization, as opposed to the repositories of its members
+	backupCmd.PersistentFlags().StringSlice("org", []string{}, "Back up repositories owned by an organization")
+	internal.Viper.BindPFlag("orgs", backupCmd.PersistentFlags().Lookup("org"))
+	internal.Viper.SetDefault("orgs", []string{})
 
 	// Optionally, backup stars as well
 	backupCmd.PersistentFlags().BoolP("backup-stars", "s", false, "Backup starred repositories")
@@ -82,4 +156,205 @@ func init() {
 	internal.Viper.BindPFlag("ntfy-url", backupCmd.PersistentFlags().Lookup("ntfy-url"))
 	internal.Viper.SetDefault("ntfy-url", "")
 
+	// Fetch into existing clones instead of cloning them again
+	backupCmd.PersistentFlags().Bool("update", false, "Fetch into existing clones in the output directory instead of cloning them again. With `continuous`, the output directory is reused instead of rolling timestamped directories")
+	internal.Viper.BindPFlag("update", backupCmd.PersistentFlags().Lookup("update"))
+	internal.Viper.SetDefault("update", false)
+
+	backupCmd.PersistentFlags().String("clone-mode", "", "`checkout` (clone with a working tree) or `mirror` (bare clone with every ref, like `git clone --mirror`). Default is `checkout`")
+	internal.Viper.BindPFlag("clone-mode", backupCmd.PersistentFlags().Lookup("clone-mode"))
+	internal.Viper.SetDefault("clone-mode", "checkout")
+
+	backupCmd.PersistentFlags().Bool("backup-issues", false, "Export issues, issue comments, timeline events, labels, and milestones as JSON")
+	internal.Viper.BindPFlag("backup-issues", backupCmd.PersistentFlags().Lookup("backup-issues"))
+	internal.Viper.SetDefault("backup-issues", false)
+
+	backupCmd.PersistentFlags().Bool("backup-pull-requests", false, "Export pull requests, their comments, reviews, review comments, and commits as JSON, along with their patches and diffs")
+	internal.Viper.BindPFlag("backup-pull-requests", backupCmd.PersistentFlags().Lookup("backup-pull-requests"))
+	internal.Viper.SetDefault("backup-pull-requests", false)
+
+	backupCmd.PersistentFlags().Bool("backup-wikis", false, "Clone the wiki of each repository that has one")
+	internal.Viper.BindPFlag("backup-wikis", backupCmd.PersistentFlags().Lookup("backup-wikis"))
+	internal.Viper.SetDefault("backup-wikis", false)
+
+	backupCmd.PersistentFlags().Bool("backup-releases", false, "Export releases as JSON and download their assets")
+	internal.Viper.BindPFlag("backup-releases", backupCmd.PersistentFlags().Lookup("backup-releases"))
+	internal.Viper.SetDefault("backup-releases", false)
+
+	backupCmd.PersistentFlags().String("release-assets-max-size", "", "Maximum size of release assets to download per repository, such as `500mb` or `2gb`. 0 means no limit")
+	internal.Viper.BindPFlag("release-assets-max-size", backupCmd.PersistentFlags().Lookup("release-assets-max-size"))
+	internal.Viper.SetDefault("release-assets-max-size", "0")
+
+	backupCmd.PersistentFlags().Bool("backup-gists", false, "Clone gists and export their comments. Starred gists are included if stars are backed up")
+	internal.Viper.BindPFlag("backup-gists", backupCmd.PersistentFlags().Lookup("backup-gists"))
+	internal.Viper.SetDefault("backup-gists", false)
+
+	backupCmd.PersistentFlags().Bool("backup-lfs", false, "Fetch Git LFS objects referenced from any ref of repositories that use Git LFS")
+	internal.Viper.BindPFlag("backup-lfs", backupCmd.PersistentFlags().Lookup("backup-lfs"))
+	internal.Viper.SetDefault("backup-lfs", false)
+
+	backupCmd.PersistentFlags().String("archive", "", "Write backups as `tar.gz` or `tar.zst` archives instead of directories. Empty to not archive")
+	internal.Viper.BindPFlag("archive", backupCmd.PersistentFlags().Lookup("archive"))
+	internal.Viper.SetDefault("archive", "")
+
+	backupCmd.PersistentFlags().String("archive-scope", "", "`snapshot` (one archive per backup) or `repository` (one archive per repository). Default is `snapshot`")
+	internal.Viper.BindPFlag("archive-scope", backupCmd.PersistentFlags().Lookup("archive-scope"))
+	internal.Viper.SetDefault("archive-scope", "snapshot")
+
+	// Encrypting archives
+	// In the configuration file, these are nested under `encryption`
+	backupCmd.PersistentFlags().StringSlice("encryption-recipients", []string{}, "age (age1...) or SSH public keys to encrypt archives to. Requires archive with the snapshot archive scope")
+	internal.Viper.BindPFlag("encryption.recipients", backupCmd.PersistentFlags().Lookup("encryption-recipients"))
+	internal.Viper.SetDefault("encryption.recipients", []string{})
+
+	backupCmd.PersistentFlags().String("encryption-recipients-file", "", "File with age or SSH public keys to encrypt archives to, one per line. Requires archive with the snapshot archive scope")
+	internal.Viper.BindPFlag("encryption.recipients-file", backupCmd.PersistentFlags().Lookup("encryption-recipients-file"))
+	internal.Viper.SetDefault("encryption.recipients-file", "")
+
+	// Uploading backups to a storage
+	// In the configuration file, these are nested under `storage`, and the options of each type under `storage.<type>`
+	backupCmd.PersistentFlags().String("storage-type", "", "`local` (only keep backups in the output directory), `s3` (upload backups to an S3-compatible bucket), or `sftp` (upload backups to a remote host over SSH). Default is `local`")
+	internal.Viper.BindPFlag("storage.type", backupCmd.PersistentFlags().Lookup("storage-type"))
+	internal.Viper.SetDefault("storage.type", "local")
+
+	backupCmd.PersistentFlags().Bool("storage-keep-local", false, "Keep backups in the output directory after uploading them")
+	internal.Viper.BindPFlag("storage.keep-local", backupCmd.PersistentFlags().Lookup("storage-keep-local"))
+	internal.Viper.SetDefault("storage.keep-local", false)
+
+	backupCmd.PersistentFlags().String("storage-s3-endpoint", "", "Host of the S3-compatible server, such as `s3.amazonaws.com` or `minio.example.com:9000`")
+	internal.Viper.BindPFlag("storage.s3.endpoint", backupCmd.PersistentFlags().Lookup("storage-s3-endpoint"))
+	internal.Viper.SetDefault("storage.s3.endpoint", "")
+
+	backupCmd.PersistentFlags().String("storage-s3-bucket", "", "Bucket to upload backups to")
+	internal.Viper.BindPFlag("storage.s3.bucket", backupCmd.PersistentFlags().Lookup("storage-s3-bucket"))
+	internal.Viper.SetDefault("storage.s3.bucket", "")
+
+	backupCmd.PersistentFlags().String("storage-s3-prefix", "", "Prefix of the keys backups are uploaded to")
+	internal.Viper.BindPFlag("storage.s3.prefix", backupCmd.PersistentFlags().Lookup("storage-s3-prefix"))
+	internal.Viper.SetDefault("storage.s3.prefix", "")
+
+	backupCmd.PersistentFlags().String("storage-s3-region", "", "Region of the bucket. Empty to detect it")
+	internal.Viper.BindPFlag("storage.s3.region", backupCmd.PersistentFlags().Lookup("storage-s3-region"))
+	internal.Viper.SetDefault("storage.s3.region", "")
+
+	backupCmd.PersistentFlags().String("storage-s3-access-key-id", "", "Access key ID. Empty to use AWS_ACCESS_KEY_ID, MINIO_ACCESS_KEY, or the instance's IAM role")
+	internal.Viper.BindPFlag("storage.s3.access-key-id", backupCmd.PersistentFlags().Lookup("storage-s3-access-key-id"))
+	internal.Viper.SetDefault("storage.s3.access-key-id", "")
+
+	backupCmd.PersistentFlags().String("storage-s3-secret-access-key", "", "Secret access key")
+	internal.Viper.BindPFlag("storage.s3.secret-access-key", backupCmd.PersistentFlags().Lookup("storage-s3-secret-access-key"))
+	internal.Viper.SetDefault("storage.s3.secret-access-key", "")
+
+	backupCmd.PersistentFlags().Bool("storage-s3-path-style", false, "Use path-style URLs (endpoint/bucket), which MinIO needs by default")
+	internal.Viper.BindPFlag("storage.s3.path-style", backupCmd.PersistentFlags().Lookup("storage-s3-path-style"))
+	internal.Viper.SetDefault("storage.s3.path-style", false)
+
+	backupCmd.PersistentFlags().Bool("storage-s3-insecure", false, "Use HTTP instead of HTTPS")
+	internal.Viper.BindPFlag("storage.s3.insecure", backupCmd.PersistentFlags().Lookup("storage-s3-insecure"))
+	internal.Viper.SetDefault("storage.s3.insecure", false)
+
+	backupCmd.PersistentFlags().String("storage-sftp-host", "", "Host to upload backups to over SFTP, such as `backup.example.com` or `backup.example.com:2222`")
+	internal.Viper.BindPFlag("storage.sftp.host", backupCmd.PersistentFlags().Lookup("storage-sftp-host"))
+	internal.Viper.SetDefault("storage.sftp.host", "")
+
+	backupCmd.PersistentFlags().String("storage-sftp-user", "", "User to log in to the SFTP host as")
+	internal.Viper.BindPFlag("storage.sftp.user", backupCmd.PersistentFlags().Lookup("storage-sftp-user"))
+	internal.Viper.SetDefault("storage.sftp.user", "")
+
+	backupCmd.PersistentFlags().String("storage-sftp-path", "", "Directory on the SFTP host to upload backups to. Relative to the user's home directory unless absolute")
+	internal.Viper.BindPFlag("storage.sftp.path", backupCmd.PersistentFlags().Lookup("storage-sftp-path"))
+	internal.Viper.SetDefault("storage.sftp.path", "")
+
+	backupCmd.PersistentFlags().String("storage-sftp-key-file", "", "Private key to authenticate to the SFTP host with")
+	internal.Viper.BindPFlag("storage.sftp.key-file", backupCmd.PersistentFlags().Lookup("storage-sftp-key-file"))
+	internal.Viper.SetDefault("storage.sftp.key-file", "~/.ssh/id_ed25519")
+
+	backupCmd.PersistentFlags().String("storage-sftp-key-passphrase", "", "Passphrase of the private key, if it is encrypted")
+	internal.Viper.BindPFlag("storage.sftp.key-passphrase", backupCmd.PersistentFlags().Lookup("storage-sftp-key-passphrase"))
+	internal.Viper.SetDefault("storage.sftp.key-passphrase", "")
+
+	backupCmd.PersistentFlags().String("storage-sftp-known-hosts-file", "", "known_hosts file the SFTP host's key is checked against")
+	internal.Viper.BindPFlag("storage.sftp.known-hosts-file", backupCmd.PersistentFlags().Lookup("storage-sftp-known-hosts-file"))
+	internal.Viper.SetDefault("storage.sftp.known-hosts-file", "~/.ssh/known_hosts")
+
+	backupCmd.PersistentFlags().Int("concurrency", 0, "Number of repositories and gists to back up at once")
+	internal.Viper.BindPFlag("concurrency", backupCmd.PersistentFlags().Lookup("concurrency"))
+	internal.Viper.SetDefault("concurrency", 4)
+
+	backupCmd.PersistentFlags().Int("per-host-concurrency", 0, "Number of repositories and gists to back up at once from the same host. 0 means no limit besides concurrency")
+	internal.Viper.BindPFlag("per-host-concurrency", backupCmd.PersistentFlags().Lookup("per-host-concurrency"))
+	internal.Viper.SetDefault("per-host-concurrency", 0)
+
+	// Retrying transient failures
+	// In the configuration file, these are nested under `retry`
+	backupCmd.PersistentFlags().Int("retry-attempts", 0, "Number of attempts for clones, fetches, and API calls that fail with a transient error, including the first one")
+	internal.Viper.BindPFlag("retry.attempts", backupCmd.PersistentFlags().Lookup("retry-attempts"))
+	internal.Viper.SetDefault("retry.attempts", 3)
+
+	backupCmd.PersistentFlags().Duration("retry-initial-backoff", 0, "Time to wait before the first retry. It doubles for every retry after that")
+	internal.Viper.BindPFlag("retry.initial-backoff", backupCmd.PersistentFlags().Lookup("retry-initial-backoff"))
+	internal.Viper.SetDefault("retry.initial-backoff", "2s")
+
+	backupCmd.PersistentFlags().Duration("retry-max-backoff", 0, "Maximum time to wait between attempts")
+	internal.Viper.BindPFlag("retry.max-backoff", backupCmd.PersistentFlags().Lookup("retry-max-backoff"))
+	internal.Viper.SetDefault("retry.max-backoff", "1m")
+
+	backupCmd.PersistentFlags().Float64("retry-jitter", 0, "Fraction (0 to 1) of each backoff that is randomized")
+	internal.Viper.BindPFlag("retry.jitter", backupCmd.PersistentFlags().Lookup("retry-jitter"))
+	internal.Viper.SetDefault("retry.jitter", 0.2)
+
+	// Filters for which repositories are backed up
+	// In the configuration file, these are nested under `filter`
+	backupCmd.PersistentFlags().String("filter-forks", "", "`include`, `exclude`, or `only` forks. Default is `include`")
+	internal.Viper.BindPFlag("filter.forks", backupCmd.PersistentFlags().Lookup("filter-forks"))
+	internal.Viper.SetDefault("filter.forks", "include")
+
+	backupCmd.PersistentFlags().String("filter-archived", "", "`include`, `exclude`, or `only` archived repositories. Default is `include`")
+	internal.Viper.BindPFlag("filter.archived", backupCmd.PersistentFlags().Lookup("filter-archived"))
+	internal.Viper.SetDefault("filter.archived", "include")
+
+	backupCmd.PersistentFlags().StringSlice("filter-visibility", []string{}, "Only back up repositories with these visibilities: `public`, `private`, or `internal`")
+	internal.Viper.BindPFlag("filter.visibility", backupCmd.PersistentFlags().Lookup("filter-visibility"))
+	internal.Viper.SetDefault("filter.visibility", []string{})
+
+	backupCmd.PersistentFlags().StringSlice("filter-owners", []string{}, "Only back up repositories owned by these users or organizations")
+	internal.Viper.BindPFlag("filter.owners", backupCmd.PersistentFlags().Lookup("filter-owners"))
+	internal.Viper.SetDefault("filter.owners", []string{})
+
+	backupCmd.PersistentFlags().StringSlice("filter-exclude-owners", []string{}, "Don't back up repositories owned by these users or organizations")
+	internal.Viper.BindPFlag("filter.exclude-owners", backupCmd.PersistentFlags().Lookup("filter-exclude-owners"))
+	internal.Viper.SetDefault("filter.exclude-owners", []string{})
+
+	backupCmd.PersistentFlags().StringSlice("filter-topics", []string{}, "Only back up repositories with at least one of these topics")
+	internal.Viper.BindPFlag("filter.topics", backupCmd.PersistentFlags().Lookup("filter-topics"))
+	internal.Viper.SetDefault("filter.topics", []string{})
+
+	backupCmd.PersistentFlags().StringSlice("filter-exclude-topics", []string{}, "Don't back up repositories with any of these topics")
+	internal.Viper.BindPFlag("filter.exclude-topics", backupCmd.PersistentFlags().Lookup("filter-exclude-topics"))
+	internal.Viper.SetDefault("filter.exclude-topics", []string{})
+
+	backupCmd.PersistentFlags().StringSlice("filter-languages", []string{}, "Only back up repositories whose primary language is one of these")
+	internal.Viper.BindPFlag("filter.languages", backupCmd.PersistentFlags().Lookup("filter-languages"))
+	internal.Viper.SetDefault("filter.languages", []string{})
+
+	backupCmd.PersistentFlags().StringSlice("filter-exclude-languages", []string{}, "Don't back up repositories whose primary language is one of these")
+	internal.Viper.BindPFlag("filter.exclude-languages", backupCmd.PersistentFlags().Lookup("filter-exclude-languages"))
+	internal.Viper.SetDefault("filter.exclude-languages", []string{})
+
+	backupCmd.PersistentFlags().String("filter-min-size", "", "Only back up repositories at least this large, such as `10mb`. 0 means no limit")
+	internal.Viper.BindPFlag("filter.min-size", backupCmd.PersistentFlags().Lookup("filter-min-size"))
+	internal.Viper.SetDefault("filter.min-size", "0")
+
+	backupCmd.PersistentFlags().String("filter-max-size", "", "Only back up repositories at most this large, such as `1gb`. 0 means no limit")
+	internal.Viper.BindPFlag("filter.max-size", backupCmd.PersistentFlags().Lookup("filter-max-size"))
+	internal.Viper.SetDefault("filter.max-size", "0")
+
+	backupCmd.PersistentFlags().StringSlice("filter-names", []string{}, "Only back up repositories whose full name matches one of these globs, or regular expressions if wrapped in slashes")
+	internal.Viper.BindPFlag("filter.names", backupCmd.PersistentFlags().Lookup("filter-names"))
+	internal.Viper.SetDefault("filter.names", []string{})
+
+	backupCmd.PersistentFlags().StringSlice("filter-exclude-names", []string{}, "Don't back up repositories whose full name matches one of these globs, or regular expressions if wrapped in slashes")
+	internal.Viper.BindPFlag("filter.exclude-names", backupCmd.PersistentFlags().Lookup("filter-exclude-names"))
+	internal.Viper.SetDefault("filter.exclude-names", []string{})
+
 }
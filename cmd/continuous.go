@@ -4,38 +4,89 @@ Copyright © 2024 Angad Behl
 package cmd
 
 import (
+	"os"
+
 	"github.com/charmbracelet/log"
 	"github.com/slashtechno/gobackup-github/internal"
 	"github.com/slashtechno/gobackup-github/pkg/backup"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // continuousCmd represents the continuous command
 var continuousCmd = &cobra.Command{
-	Use:   "continuous --interval INTERVAL",
-	Short: "Start a rolling backup that backs up repositories at a set interval",
-	Long:  `Start a rolling backup that backs up repositories at a set interval.`,
+	Use:   "continuous [--interval INTERVAL | --cron EXPRESSION]",
+	Short: "Start a rolling backup that backs up repositories at a set interval or on a cron schedule",
+	Long: `Start a rolling backup that backs up repositories at a set interval or on a cron schedule.
+	With --cron, backups run at the times matched by the expression, such as "30 2 * * *" for 02:30 every night or "0 3 * * 1-5" for 03:00 on weekdays, in --timezone if set.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if preview, _ := cmd.Flags().GetBool("retention-dry-run"); preview {
+			err := backup.PreviewRetention(backupConfigFromViper(), internal.Viper.GetInt("max-backups"), os.Stdout)
+			if err != nil {
+				log.Fatal("Failed to preview retention", "err", err)
+			}
+			return
+		}
+		schedule := backup.Schedule{
+			Interval: internal.Viper.GetString("interval"),
+			Cron:     internal.Viper.GetString("cron"),
+			Timezone: internal.Viper.GetString("timezone"),
+		}
+		// interval has a default, so only warn if it was set explicitly
+		if schedule.Cron != "" && (cmd.Flags().Changed("interval") || internal.Viper.InConfig("interval")) {
+			log.Warn("Both interval and cron are set; using cron and ignoring interval", "interval", schedule.Interval, "cron", schedule.Cron)
+		}
 		err := backup.StartBackup(
-			backup.BackupConfig{
-				Usernames:         internal.Viper.GetStringSlice("usernames"),
-				InOrg:             internal.Viper.GetStringSlice("in-org"),
-				BackupStars:       internal.Viper.GetBool("stars"),
-				Token:             internal.Viper.GetString("token"),
-				Output:            internal.Viper.GetString("output"),
-				RunType:           internal.Viper.GetString("run-type"),
-				NtfyUrl:           internal.Viper.GetString("ntfy-url"),
-				RecurseSubmodules: internal.Viper.GetUint("recurse-submodules"),
-			},
-			internal.Viper.GetString("interval"),
+			backupConfigFromViper(),
+			schedule,
 			internal.Viper.GetInt("max-backups"),
 		)
 		if err != nil {
-			log.Error("Backup failed", "err", err)
+			log.Fatal("Backup failed", "err", err)
 		}
 	},
 }
 
+// The flags of max-backups and the retention policy, which are shared by `backup continuous` and `snapshots prune`.
+// Viper can only bind a key to one flag, so both commands add this flag set instead of defining their own flags.
+var retentionFlags = newRetentionFlags()
+
+func newRetentionFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("retention", pflag.ExitOnError)
+
+	flags.IntP("max-backups", "n", 0, "Number of backups to keep")
+	internal.Viper.BindPFlag("max-backups", flags.Lookup("max-backups"))
+	internal.Viper.SetDefault("max-backups", 1)
+
+	// Retention policy, alongside max-backups
+	// In the configuration file, these are nested under `retention`
+	flags.Int("keep-hourly", 0, "Number of hours to keep the most recent backup of")
+	internal.Viper.BindPFlag("retention.keep-hourly", flags.Lookup("keep-hourly"))
+	internal.Viper.SetDefault("retention.keep-hourly", 0)
+
+	flags.Int("keep-daily", 0, "Number of days to keep the most recent backup of")
+	internal.Viper.BindPFlag("retention.keep-daily", flags.Lookup("keep-daily"))
+	internal.Viper.SetDefault("retention.keep-daily", 0)
+
+	flags.Int("keep-weekly", 0, "Number of weeks to keep the most recent backup of")
+	internal.Viper.BindPFlag("retention.keep-weekly", flags.Lookup("keep-weekly"))
+	internal.Viper.SetDefault("retention.keep-weekly", 0)
+
+	flags.Int("keep-monthly", 0, "Number of months to keep the most recent backup of")
+	internal.Viper.BindPFlag("retention.keep-monthly", flags.Lookup("keep-monthly"))
+	internal.Viper.SetDefault("retention.keep-monthly", 0)
+
+	flags.Int("keep-yearly", 0, "Number of years to keep the most recent backup of")
+	internal.Viper.BindPFlag("retention.keep-yearly", flags.Lookup("keep-yearly"))
+	internal.Viper.SetDefault("retention.keep-yearly", 0)
+
+	flags.Duration("keep-within", 0, "Keep every backup made within this duration of the most recent one, such as `168h`")
+	internal.Viper.BindPFlag("retention.keep-within", flags.Lookup("keep-within"))
+	internal.Viper.SetDefault("retention.keep-within", "0s")
+
+	return flags
+}
+
 func init() {
 	backupCmd.AddCommand(continuousCmd)
 
@@ -43,8 +94,20 @@ func init() {
 	internal.Viper.BindPFlag("interval", continuousCmd.Flags().Lookup("interval"))
 	internal.Viper.SetDefault("interval", "24h")
 
-	continuousCmd.Flags().IntP("max-backups", "n", 0, "Number of backups to keep")
-	internal.Viper.BindPFlag("max-backups", continuousCmd.Flags().Lookup("max-backups"))
-	internal.Viper.SetDefault("max-backups", 1)
+	continuousCmd.Flags().String("cron", "", "Cron expression to run backups on instead of an interval, such as `30 2 * * *`")
+	internal.Viper.BindPFlag("cron", continuousCmd.Flags().Lookup("cron"))
+	internal.Viper.SetDefault("cron", "")
+
+	continuousCmd.Flags().String("timezone", "", "IANA timezone the cron expression is evaluated in, such as `Europe/Berlin`. Empty for local time")
+	internal.Viper.BindPFlag("timezone", continuousCmd.Flags().Lookup("timezone"))
+	internal.Viper.SetDefault("timezone", "")
+
+	continuousCmd.Flags().Bool("deduplicate", false, "Create clones from the previous backup and hard link their objects instead of cloning from scratch")
+	internal.Viper.BindPFlag("deduplicate", continuousCmd.Flags().Lookup("deduplicate"))
+	internal.Viper.SetDefault("deduplicate", false)
+
+	continuousCmd.Flags().AddFlagSet(retentionFlags)
+
+	continuousCmd.Flags().Bool("retention-dry-run", false, "Print which backups the retention policy would keep and remove before the next backup, then exit without backing up")
 
 }
@@ -0,0 +1,54 @@
+/*
+Copyright © 2024 Angad Behl
+*/
+package cmd
+
+import (
+	"path/filepath"
+
+	"filippo.io/age"
+	"github.com/charmbracelet/log"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// decryptCmd represents the decrypt command
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt ARCHIVE --identity FILE",
+	Short: "Decrypt and extract an encrypted archive",
+	Long: `Decrypt an archive that was encrypted with encryption recipients and extract it to a directory, so it can be restored.
+	Unencrypted archives can be extracted as well.
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		archive := args[0]
+		identityFile, _ := cmd.Flags().GetString("identity")
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			// Extract next to the archive, named after the directory it was created from
+			output, _ = utils.TrimArchiveExtension(archive)
+			output = filepath.Clean(output)
+		}
+
+		var identities []age.Identity
+		if identityFile != "" {
+			var err error
+			identities, err = utils.ParseIdentitiesFile(identityFile)
+			if err != nil {
+				log.Fatal("Failed to read identity file", "file", identityFile, "err", err)
+			}
+		}
+		err := utils.ExtractArchive(archive, output, identities...)
+		if err != nil {
+			log.Fatal("Failed to decrypt archive", "archive", archive, "err", err)
+		}
+		log.Info("Extracted archive", "path", output)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(decryptCmd)
+
+	decryptCmd.Flags().String("identity", "", "File with the age secret keys or SSH private key to decrypt with")
+	decryptCmd.Flags().StringP("output", "o", "", "Directory to extract to. Defaults to the archive's path without its extensions")
+}
@@ -0,0 +1,64 @@
+/*
+Copyright © 2024 Angad Behl
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/charmbracelet/log"
+	"github.com/slashtechno/gobackup-github/internal"
+	"github.com/slashtechno/gobackup-github/pkg/backup"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff SNAPSHOT_A SNAPSHOT_B",
+	Short: "Show what changed between two backups",
+	Long: `Show the repositories that were added, removed, or renamed between two backups, the branches that were created, deleted, moved, or force-pushed, and the tags that were created, deleted, or retagged.
+	A branch was force-pushed if the commit it pointed to in SNAPSHOT_A isn't an ancestor of the commit it points to in SNAPSHOT_B, meaning history was rewritten. Any tag that points to something else was retagged.
+	A repository was renamed if it was removed and exactly one added repository has the same default branch, or, failing that, exactly one has a default branch that contains it.
+	SNAPSHOT_A and SNAPSHOT_B are backup directories, archives of them, or the IDs of snapshots in the output directory (see "gobackup-github snapshots list"). SNAPSHOT_A should be the older one.
+	`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		identities := snapshotIdentities(cmd)
+		var paths []string
+		for _, arg := range args {
+			// Paths take precedence over snapshot IDs
+			if _, err := os.Stat(arg); err == nil {
+				paths = append(paths, arg)
+				continue
+			}
+			snapshot, err := backup.FindSnapshot(internal.Viper.GetString("output"), arg, identities)
+			if err != nil {
+				log.Fatal("Failed to find snapshot", "snapshot", arg, "err", err)
+			}
+			paths = append(paths, snapshot.Path)
+		}
+
+		diff, err := backup.DiffSnapshots(paths[0], paths[1], identities)
+		if err != nil {
+			log.Fatal("Failed to compare backups", "err", err)
+		}
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(diff)
+		} else {
+			err = backup.PrintDiff(os.Stdout, diff)
+		}
+		if err != nil {
+			log.Fatal("Failed to write diff", "err", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().String("identity", "", "File with the age secret keys or SSH private key to decrypt encrypted backups with")
+	diffCmd.Flags().Bool("json", false, "Write the diff as JSON, such as for a scheduled report")
+}
@@ -0,0 +1,76 @@
+/*
+Copyright © 2024 Angad Behl
+*/
+package cmd
+
+import (
+	"filippo.io/age"
+	"github.com/charmbracelet/log"
+	"github.com/slashtechno/gobackup-github/internal"
+	"github.com/slashtechno/gobackup-github/pkg/backup"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore SNAPSHOT [REPOSITORY...]",
+	Short: "Push repositories from a backup to GitHub or another remote",
+	Long: `Push every branch and tag of repositories in a backup to GitHub or another remote.
+	SNAPSHOT is a backup directory or an archive of one. REPOSITORY selects repositories by full name, as globs (such as "octocat/*") or regular expressions wrapped in slashes. Every repository is restored if none are given.
+	On GitHub, repositories are restored to --owner (the authenticated user by default) and created if they don't exist. With --remote, they are pushed to the URL instead, such as "git@gitlab.com:backups/{name}.git".
+	Existing branches and tags with the same names are overwritten. Issues, pull requests, releases, and Git LFS objects aren't restored.
+	`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		identityFile, _ := cmd.Flags().GetString("identity")
+		var identities []age.Identity
+		if identityFile != "" {
+			var err error
+			identities, err = utils.ParseIdentitiesFile(identityFile)
+			if err != nil {
+				log.Fatal("Failed to read identity file", "file", identityFile, "err", err)
+			}
+		}
+		owner, _ := cmd.Flags().GetString("owner")
+		remote, _ := cmd.Flags().GetString("remote")
+		remoteToken, _ := cmd.Flags().GetString("remote-token")
+		public, _ := cmd.Flags().GetBool("public")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if owner != "" && remote != "" {
+			log.Fatal("--owner and --remote can't be used together; use {owner} in --remote instead")
+		}
+
+		err := backup.Restore(backup.RestoreConfig{
+			Snapshot:     args[0],
+			Identities:   identities,
+			Repositories: args[1:],
+			Owner:        owner,
+			Token:        internal.Viper.GetString("token"),
+			Private:      !public,
+			Remote:       remote,
+			RemoteToken:  remoteToken,
+			DryRun:       dryRun,
+			Retry: backup.RetryPolicy{
+				Attempts:       internal.Viper.GetInt("retry.attempts"),
+				InitialBackoff: internal.Viper.GetDuration("retry.initial-backoff"),
+				MaxBackoff:     internal.Viper.GetDuration("retry.max-backoff"),
+				Jitter:         internal.Viper.GetFloat64("retry.jitter"),
+			},
+		})
+		if err != nil {
+			log.Fatal("Restore failed", "err", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	restoreCmd.Flags().String("owner", "", "GitHub user or organization to restore to. Defaults to the authenticated user")
+	restoreCmd.Flags().Bool("public", false, "Create missing GitHub repositories as public instead of private")
+	restoreCmd.Flags().String("remote", "", "URL to push to instead of GitHub, where {owner} and {name} are replaced with each repository's owner and name")
+	restoreCmd.Flags().String("remote-token", "", "Token to authenticate to an HTTP(S) --remote with. SSH remotes use the SSH agent")
+	restoreCmd.Flags().String("identity", "", "File with the age secret keys or SSH private key to decrypt an encrypted backup with")
+	restoreCmd.Flags().Bool("dry-run", false, "Print which repositories would be restored where without creating or pushing anything")
+}
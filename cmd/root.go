@@ -52,4 +52,13 @@ func init() {
 	rootCmd.PersistentFlags().String("log-level", "", "log level")
 	internal.Viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level"))
 	internal.Viper.SetDefault("log-level", "info")
+
+	// Used by backup as well as the commands that read backups (verify, diff, snapshots) or push them (restore)
+	rootCmd.PersistentFlags().StringP("token", "t", "", "GitHub token")
+	internal.Viper.BindPFlag("token", rootCmd.PersistentFlags().Lookup("token"))
+	internal.Viper.SetDefault("token", "")
+
+	rootCmd.PersistentFlags().StringP("output", "o", "", "Output directory")
+	internal.Viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
+	internal.Viper.SetDefault("output", "backup")
 }
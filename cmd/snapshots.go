@@ -0,0 +1,107 @@
+/*
+Copyright © 2024 Angad Behl
+*/
+package cmd
+
+import (
+	"os"
+
+	"filippo.io/age"
+	"github.com/charmbracelet/log"
+	"github.com/slashtechno/gobackup-github/internal"
+	"github.com/slashtechno/gobackup-github/pkg/backup"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// snapshotsCmd represents the snapshots command
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "List, inspect, and prune the backups made by `backup continuous`",
+	Long: `List, inspect, and prune the timestamped backups in the output directory made by "gobackup-github backup continuous".
+	Snapshots are identified by their timestamp, such as 2024-01-31-02-30-00, or any prefix of it that only one snapshot has.
+	`,
+}
+
+var snapshotsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots with their repository count, size, and status",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		snapshots, err := backup.ListSnapshots(internal.Viper.GetString("output"), snapshotIdentities(cmd))
+		if err != nil {
+			log.Fatal("Failed to list snapshots", "err", err)
+		}
+		backup.PrintSnapshots(os.Stdout, snapshots)
+	},
+}
+
+var snapshotsShowCmd = &cobra.Command{
+	Use:   "show ID",
+	Short: "Show the details of a snapshot and each repository and gist in it",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		snapshot, err := backup.FindSnapshot(internal.Viper.GetString("output"), args[0], snapshotIdentities(cmd))
+		if err != nil {
+			log.Fatal("Failed to find snapshot", "err", err)
+		}
+		err = backup.PrintSnapshot(os.Stdout, snapshot)
+		if err != nil {
+			log.Fatal("Failed to show snapshot", "err", err)
+		}
+	},
+}
+
+var snapshotsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove the snapshots the retention policy doesn't keep",
+	Long: `Remove the snapshots that max-backups and the retention policy don't keep, from the output directory and the storage if one is configured.
+	Either max-backups or a retention policy must be set, in the configuration file or with flags, so the default max-backups of 1 doesn't remove every snapshot but the most recent one.
+	This is what "gobackup-github backup continuous" does before each backup, except that the most recent existing snapshot counts as the most recent one.
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		// Pruning with the default max-backups of 1 would remove every snapshot but the most recent one
+		if !dryRun && !retentionConfigured(cmd) {
+			log.Fatal("Refusing to prune without max-backups or a retention policy; set them in the configuration file or with --max-backups and --keep-*, or run with --dry-run to see what would be removed")
+		}
+		err := backup.PruneSnapshots(backupConfigFromViper(), internal.Viper.GetInt("max-backups"), dryRun, os.Stdout)
+		if err != nil {
+			log.Fatal("Failed to prune snapshots", "err", err)
+		}
+	},
+}
+
+// Whether max-backups or the retention policy was set with a flag, the configuration file, or an environment variable, rather than left at its default
+func retentionConfigured(cmd *cobra.Command) bool {
+	if cmd.Flags().Changed("max-backups") || internal.Viper.InConfig("max-backups") {
+		return true
+	}
+	if _, ok := os.LookupEnv("GOBACKUP_GITHUB_MAX_BACKUPS"); ok {
+		return true
+	}
+	return !backupConfigFromViper().Retention.IsEmpty()
+}
+
+// Parse the identity file passed to a snapshots command, if any
+func snapshotIdentities(cmd *cobra.Command) []age.Identity {
+	identityFile, _ := cmd.Flags().GetString("identity")
+	if identityFile == "" {
+		return nil
+	}
+	identities, err := utils.ParseIdentitiesFile(identityFile)
+	if err != nil {
+		log.Fatal("Failed to read identity file", "file", identityFile, "err", err)
+	}
+	return identities
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotsCmd)
+	snapshotsCmd.AddCommand(snapshotsListCmd, snapshotsShowCmd, snapshotsPruneCmd)
+
+	snapshotsCmd.PersistentFlags().String("identity", "", "File with the age secret keys or SSH private key to read encrypted snapshots with")
+	snapshotsPruneCmd.Flags().AddFlagSet(retentionFlags)
+	snapshotsPruneCmd.Flags().Bool("dry-run", false, "Print which snapshots would be kept and removed without removing anything")
+}
@@ -0,0 +1,61 @@
+/*
+Copyright © 2024 Angad Behl
+*/
+package cmd
+
+import (
+	"os"
+
+	"filippo.io/age"
+	"github.com/charmbracelet/log"
+	"github.com/slashtechno/gobackup-github/internal"
+	"github.com/slashtechno/gobackup-github/pkg/backup"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify [SNAPSHOT]",
+	Short: "Check that the repositories in a backup are intact",
+	Long: `Check that every repository and gist in a backup can be restored.
+	Every object reachable from a branch or tag must exist and match its hash, and every ref must point to what was recorded in the manifest when the backup was made.
+	SNAPSHOT is a backup directory or an archive of one. It defaults to the output directory if it is a backup, or the most recent backup in it otherwise.
+	Exits with a non-zero status if any repository or gist is missing, corrupt, or doesn't match the manifest.
+	`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var snapshot string
+		if len(args) > 0 {
+			snapshot = args[0]
+		} else {
+			var err error
+			snapshot, err = backup.LatestSnapshot(internal.Viper.GetString("output"))
+			if err != nil {
+				log.Fatal("Failed to find a backup to verify", "err", err)
+			}
+		}
+
+		identityFile, _ := cmd.Flags().GetString("identity")
+		var identities []age.Identity
+		if identityFile != "" {
+			var err error
+			identities, err = utils.ParseIdentitiesFile(identityFile)
+			if err != nil {
+				log.Fatal("Failed to read identity file", "file", identityFile, "err", err)
+			}
+		}
+
+		log.Info("Verifying backup", "path", snapshot)
+		err := backup.Verify(snapshot, identities, os.Stdout)
+		if err != nil {
+			log.Fatal("Verification failed", "err", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().String("identity", "", "File with the age secret keys or SSH private key to decrypt an encrypted backup with")
+}
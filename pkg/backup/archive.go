@@ -0,0 +1,74 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"github.com/charmbracelet/log"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+// Check the archive settings before anything is cloned and parse the recipients archives are encrypted to, if any
+func validateArchiveConfig(config BackupConfig) ([]age.Recipient, error) {
+	recipients, err := utils.ParseRecipients(config.EncryptionRecipients, config.EncryptionRecipientsFile)
+	if err != nil {
+		return nil, err
+	}
+	if config.Archive == "" {
+		if len(recipients) > 0 {
+			return nil, fmt.Errorf("encryption needs archive to be set, as archives are what is encrypted")
+		}
+		return nil, nil
+	}
+	if _, ok := utils.ArchiveExtensions[config.Archive]; !ok {
+		return nil, fmt.Errorf("invalid archive format: %s; must be one of `tar.gz` or `tar.zst`", config.Archive)
+	}
+	if config.ArchiveScope != "" && config.ArchiveScope != "snapshot" && config.ArchiveScope != "repository" {
+		return nil, fmt.Errorf("invalid archive scope: %s; must be one of `snapshot` or `repository`", config.ArchiveScope)
+	}
+	if config.Update {
+		return nil, fmt.Errorf("archive can't be used with update, as updating needs the clones to be directories")
+	}
+	// Only clones are archived per repository, so exported metadata, gist JSON, and the manifest would be left unencrypted
+	if len(recipients) > 0 && config.ArchiveScope == "repository" {
+		return nil, fmt.Errorf("encryption can't be used with archive-scope `repository`, as only clones are archived per repository and everything else would be left unencrypted; use archive-scope `snapshot`")
+	}
+	return recipients, nil
+}
+
+// Replace a directory with an archive of it, named after the directory with the format's extension.
+// If there are recipients, the archive is encrypted to them and EncryptedExtension is appended.
+// Returns the path of the archive.
+func archiveDirectory(dir string, format string, recipients []age.Recipient) (string, error) {
+	dest := dir + utils.ArchiveExtensions[format]
+	if len(recipients) > 0 {
+		dest += utils.EncryptedExtension
+	}
+	err := utils.ArchiveDir(dir, dest, format, recipients...)
+	if err != nil {
+		return "", err
+	}
+	log.Debug("Archived directory", "path", dest)
+	return dest, os.RemoveAll(dir)
+}
+
+// Archive the clone at path (relative to the output directory) if it exists, returning the path of the archive relative to the output directory.
+// The error of archiving is joined with err, the error of backing up the clone.
+func archiveClone(config BackupConfig, recipients []age.Recipient, path string, err error) (string, error) {
+	dir := filepath.Join(config.Output, path)
+	if _, statErr := os.Stat(dir); statErr != nil {
+		return path, err
+	}
+	archivePath, archiveErr := archiveDirectory(dir, config.Archive, recipients)
+	if archiveErr != nil {
+		return path, errors.Join(err, withStage("archive", archiveErr))
+	}
+	relative, relErr := filepath.Rel(config.Output, archivePath)
+	if relErr != nil {
+		return path, errors.Join(err, relErr)
+	}
+	return relative, err
+}
@@ -3,10 +3,11 @@ package backup
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sync"
+	"slices"
 	"time"
 
 	"github.com/schollz/progressbar/v3"
@@ -15,6 +16,7 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/gofri/go-github-ratelimit/github_ratelimit"
 	"github.com/google/go-github/v63/github"
+	"github.com/slashtechno/gobackup-github/pkg/storage"
 	"github.com/slashtechno/gobackup-github/pkg/utils"
 )
 
@@ -28,6 +30,52 @@ type BackupConfig struct {
 	RunType           string
 	NtfyUrl           string
 	RecurseSubmodules uint
+	// Update fetches into existing clones in Output instead of cloning them again
+	Update bool
+	// CloneMode can be `checkout` (a clone with a working tree) or `mirror` (a bare clone with every ref)
+	CloneMode string
+	// BackupIssues exports issues of every backed up repository as JSON. Starred repositories are only included if BackupStars is set.
+	BackupIssues bool
+	// BackupPullRequests exports pull requests, their reviews and comments, and their patches
+	BackupPullRequests bool
+	// BackupWikis clones the wiki of each repository that has one enabled
+	BackupWikis bool
+	// BackupReleases exports releases and downloads their assets
+	BackupReleases bool
+	// ReleaseAssetsMaxSize is the maximum number of bytes of release assets to download per repository. 0 means no limit.
+	ReleaseAssetsMaxSize uint64
+	// BackupGists clones the gists of each user. Starred gists are included if BackupStars is set.
+	BackupGists bool
+	// BackupLFS fetches the Git LFS objects of repositories that use Git LFS
+	BackupLFS bool
+	// Filter decides which of the fetched repositories are backed up
+	Filter RepositoryFilter
+	// Concurrency is the number of repositories and gists backed up at once
+	Concurrency int
+	// PerHostConcurrency is the number of repositories and gists backed up at once from the same host. 0 means no limit besides Concurrency.
+	PerHostConcurrency int
+	// Retry decides how transient failures of clones, fetches, and API calls are retried
+	Retry RetryPolicy
+	// Orgs backs up the repositories owned by these organizations, as opposed to InOrg which backs up the repositories of their members
+	Orgs []string
+	// Archive can be empty (no archive), `tar.gz`, or `tar.zst`
+	Archive string
+	// ArchiveScope can be `snapshot` (archive the entire output directory) or `repository` (archive each clone)
+	ArchiveScope string
+	// EncryptionRecipients are age or SSH public keys that archives are encrypted to
+	EncryptionRecipients []string
+	// EncryptionRecipientsFile is a file with more recipients, one per line
+	EncryptionRecipientsFile string
+	// Storage is where finished backups are uploaded to, in addition to or instead of Output
+	Storage storage.Config
+	// PreviousOutput is the previous snapshot, whose clones new clones are created from with Deduplicate. Set by StartBackup when rolling directories.
+	PreviousOutput string
+	// PruneError is set by StartBackup if old backups couldn't be removed from Storage. It is reported like a failed upload instead of stopping the backup.
+	PruneError error
+	// Deduplicate creates clones from the clone in PreviousOutput, sharing their objects with hard links, instead of cloning from scratch
+	Deduplicate bool
+	// Retention decides which backups are kept when rolling directories. KeepLast is set from the maximum number of backups passed to StartBackup.
+	Retention utils.RetentionPolicy
 }
 
 func GetUsersInOrg(
@@ -58,15 +106,24 @@ func GetUsersInOrg(
 	return members, nil
 }
 
+// Make a GitHub client authenticated with token
+func newGitHubClient(token string, retry RetryPolicy) (*github.Client, error) {
+	// Make an HTTP client that waits if the rate limit is exceeded
+	// Transient failures, such as a 502 or a connection reset, are retried beneath the rate limit waiter
+	rateLimiter, err := github_ratelimit.NewRateLimitWaiterClient(newRetryClient(retry).Transport)
+	if err != nil {
+		return nil, err
+	}
+	// .WithEnterpriseURL could probably be used for something like Gitea
+	return github.NewClient(rateLimiter).WithAuthToken(token), nil
+}
+
 func Backup(config BackupConfig) error {
 	// Make a client
-	// Make an HTTP client that waits if the rate limit is exceeded
-	rateLimiter, err := github_ratelimit.NewRateLimitWaiterClient(nil)
+	client, err := newGitHubClient(config.Token, config.Retry)
 	if err != nil {
 		return err
 	}
-	// .WithEnterpriseURL could probably be used for something like Gitea
-	client := github.NewClient(rateLimiter).WithAuthToken(config.Token)
 
 	// Get users in org
 	var allUsers []string
@@ -81,6 +138,16 @@ func Backup(config BackupConfig) error {
 
 	// Get repositories
 	var repos []*github.Repository
+	// Where each repository came from, for the manifest
+	sources := make(map[string][]string)
+	addRepos := func(source string, fetched []*github.Repository) {
+		for _, repo := range fetched {
+			if !slices.Contains(sources[repo.GetFullName()], source) {
+				sources[repo.GetFullName()] = append(sources[repo.GetFullName()], source)
+			}
+		}
+		repos = append(repos, fetched...)
+	}
 	fetchConfig := &FetchConfig{
 		GetStars: config.BackupStars,
 		Client:   client,
@@ -96,10 +163,19 @@ func Backup(config BackupConfig) error {
 		if err != nil {
 			return err
 		}
-		repos = append(repos, fetchedRepos.User...)
-		repos = append(repos, fetchedRepos.Starred...)
+		addRepos("owned", fetchedRepos.User)
+		addRepos("starred", fetchedRepos.Starred)
 	}
-	if len(allUsers) == 0 {
+	for _, org := range config.Orgs {
+		orgRepos, err := GetOrgRepositories(org, client)
+		if err != nil {
+			return err
+		}
+		addRepos("org", orgRepos)
+	}
+	// Only back up the authenticated user if nothing else was specified
+	backUpAuthenticatedUser := len(allUsers) == 0 && len(config.Orgs) == 0
+	if backUpAuthenticatedUser {
 		// Just to be verbose, set the username to ""
 		fetchConfig.Username = ""
 		fetchedRepos, err := GetRepositories(
@@ -108,49 +184,142 @@ func Backup(config BackupConfig) error {
 		if err != nil {
 			return err
 		}
-		repos = append(repos, fetchedRepos.User...)
-		repos = append(repos, fetchedRepos.Starred...)
+		addRepos("owned", fetchedRepos.User)
+		addRepos("starred", fetchedRepos.Starred)
 	}
 
 	// Remove duplicates
 	noDuplicates := RemoveDuplicateRepositories(repos)
 	log.Info("Deduplicated repositories", "count", len(noDuplicates))
+	noDuplicates, err = FilterRepositories(noDuplicates, config.Filter)
+	if err != nil {
+		return err
+	}
+	log.Info("Filtered repositories", "count", len(noDuplicates))
+
+	var gists []*github.Gist
+	if config.BackupGists && (len(allUsers) > 0 || backUpAuthenticatedUser) {
+		// Gists.List fetches the authenticated user's gists if allUsers is empty
+		gists, err = GetGists(client, allUsers, config.BackupStars)
+		if err != nil {
+			return err
+		}
+		log.Info("Fetched gists", "count", len(gists))
+	}
+
+	var failures []BackupFailure
+	// Set if the backup was written but couldn't be uploaded to the storage
+	var store storage.Storage
+	var uploadErr error
 	if config.RunType == "clone" {
-		log.Info("Cloning repositories")
+		if config.CloneMode != "" && config.CloneMode != "checkout" && config.CloneMode != "mirror" {
+			return fmt.Errorf("invalid clone mode: %s; must be one of `checkout` or `mirror`", config.CloneMode)
+		}
+		recipients, err := validateArchiveConfig(config)
+		if err != nil {
+			return err
+		}
+		store, err = storage.New(config.Storage)
+		if err != nil {
+			return err
+		}
+		log.Info("Cloning repositories", "mode", config.CloneMode)
 
 		// Unlike os.Mkdir, os.MkdirAll won't return an error if the directory already exists. It also creates any necessary parent directories.
 		// With rolling backups, this shouldn't do anything since the directory ~~will~~ should already exist
-		err := os.MkdirAll(config.Output, 0755)
+		err = os.MkdirAll(config.Output, 0755)
 		if err != nil {
 			return err
 		}
 
-		var wg sync.WaitGroup
-		errChan := make(chan error, len(noDuplicates))
-		bar := progressbar.Default(int64(len(noDuplicates)))
+		concurrency := config.Concurrency
+		if concurrency < 1 {
+			log.Warn("concurrency must be greater than 0. Setting to 1", "concurrency", concurrency)
+			concurrency = 1
+		}
 
+		manifest := &Manifest{StartedAt: time.Now(), CloneMode: config.CloneMode}
+		var jobs []backupJob
 		for _, repo := range noDuplicates {
-			wg.Add(1)
-			go func(repo *github.Repository) {
-				defer wg.Done()
+			jobs = append(jobs, backupJob{
+				name: repo.GetFullName(),
+				host: hostOf(repo.GetCloneURL()),
+				run: func() error {
+					start := time.Now()
+					err := backupRepository(client, repo, config)
+					entry := newManifestEntry(repo.GetFullName(), config.Output, repo.GetFullName(), sources[repo.GetFullName()], time.Since(start), err)
+					entry.DefaultBranch = repo.GetDefaultBranch()
+					entry.PushedAt = repo.PushedAt
+					if config.Archive != "" && config.ArchiveScope == "repository" {
+						entry.Path, err = archiveClone(config, recipients, repo.GetFullName(), err)
+						if config.BackupWikis && repo.GetHasWiki() {
+							_, err = archiveClone(config, recipients, repo.GetFullName()+".wiki", err)
+						}
+						entry.setStatus(err)
+					}
+					manifest.add(entry, false)
+					return err
+				},
+			})
+		}
+		for _, gist := range gists {
+			jobs = append(jobs, backupJob{
+				name: "gist " + gist.GetID(),
+				host: hostOf(gist.GetGitPullURL()),
+				run: func() error {
+					start := time.Now()
+					err := backupGist(client, gist, config)
+					entry := newManifestEntry(gist.GetID(), config.Output, gistPath(gist), []string{"gist"}, time.Since(start), err)
+					if config.Archive != "" && config.ArchiveScope == "repository" {
+						entry.Path, err = archiveClone(config, recipients, gistPath(gist), err)
+						entry.setStatus(err)
+					}
+					manifest.add(entry, true)
+					if err != nil {
+						return err
+					}
+					log.Debug("Cloned gist", "gist", gist.GetID())
+					return nil
+				},
+			})
+		}
 
-				err := cloneRepository(repo, config)
-				if err != nil {
-					errChan <- err
-					return
-				}
+		bar := progressbar.Default(int64(len(jobs)))
+		failures = runJobs(jobs, concurrency, config.PerHostConcurrency, bar)
+
+		manifest.finish()
+		err = writeJSON(filepath.Join(config.Output, ManifestFile), manifest)
+		if err != nil {
+			return err
+		}
 
-				log.Debug("Cloned repository", "repository", repo.GetFullName())
-				bar.Add(1)
-			}(repo)
+		// Write the report even if nothing failed so automation can always rely on it
+		reportPath := filepath.Join(config.Output, "failures.json")
+		err = writeJSON(reportPath, BackupReport{Total: len(jobs), Failures: withPruneFailure(failures, store, config.PruneError)})
+		if err != nil {
+			return err
+		}
+		if len(failures) > 0 {
+			log.Error("Some repositories or gists failed to back up", "failures", len(failures), "report", reportPath)
+			// Move past the progress bar
+			fmt.Println()
+			printFailures(os.Stdout, failures)
 		}
 
-		wg.Wait()
-		close(errChan)
-		for err := range errChan {
+		snapshotPath := config.Output
+		if config.Archive != "" && (config.ArchiveScope == "" || config.ArchiveScope == "snapshot") {
+			snapshotPath, err = archiveDirectory(config.Output, config.Archive, recipients)
 			if err != nil {
 				return err
 			}
+			log.Info("Archived backup", "path", snapshotPath)
+		}
+
+		if store != nil {
+			uploadErr = uploadBackup(store, config, snapshotPath)
+			if uploadErr != nil {
+				log.Error("Failed to upload backup", "storage", store, "err", uploadErr)
+			}
 		}
 
 	} else if config.RunType == "fetch" {
@@ -193,93 +362,173 @@ func Backup(config BackupConfig) error {
 
 	if config.NtfyUrl != "" {
 		log.Info("Sending notification", "url", config.NtfyUrl)
-		_, err := resty.New().R().SetHeader("Tags", "tada").SetBody("Backup complete").Post(config.NtfyUrl)
+		tags, body := "tada", "Backup complete"
+		if len(failures) > 0 {
+			tags, body = "warning", fmt.Sprintf("Backup complete with %d failures", len(failures))
+		}
+		if uploadErr != nil {
+			tags, body = "warning", fmt.Sprintf("%s, but uploading to %s failed: %v", body, store, uploadErr)
+		} else if store != nil {
+			body = fmt.Sprintf("%s and uploaded to %s", body, store)
+		}
+		if config.PruneError != nil {
+			tags, body = "warning", fmt.Sprintf("%s, but pruning the storage failed: %v", body, config.PruneError)
+		}
+		_, err := resty.New().R().SetHeader("Tags", tags).SetBody(body).Post(config.NtfyUrl)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	// Only fail once everything else has been saved
+	return backupResult(failures, store, uploadErr, config.PruneError)
+}
+
+// Clone a repository and back up everything else that is enabled for it.
+// A failed stage doesn't stop the other stages, except for stages that depend on the clone.
+// The errors of every failed stage are joined.
+func backupRepository(client *github.Client, repo *github.Repository, config BackupConfig) error {
+	var errs []error
+	err := cloneRepository(repo, config)
+	if err != nil {
+		errs = append(errs, withStage("clone", err))
+	} else {
+		log.Debug("Cloned repository", "repository", repo.GetFullName())
+
+		if config.BackupLFS {
+			errs = append(errs, withStage("lfs", fetchLFSObjects(repo, config)))
+		}
+	}
+
+	if config.BackupWikis {
+		errs = append(errs, withStage("wiki", cloneWiki(repo, config)))
+	}
+	if config.BackupIssues {
+		errs = append(errs, withStage("issues", exportIssues(client, repo, config.Output)))
+	}
+	if config.BackupPullRequests {
+		errs = append(errs, withStage("pull-requests", exportPullRequests(client, repo, config.Output)))
+	}
+	if config.BackupReleases {
+		errs = append(errs, withStage("releases", exportReleases(client, repo, config)))
+	}
+	// errors.Join ignores nil errors and returns nil if every error is nil
+	return errors.Join(errs...)
 }
 
 func StartBackup(
 	config BackupConfig,
-	interval string,
+	schedule Schedule,
 	maxBackups int,
 ) error {
 	backupConfig := config
 
-	// https://gobyexample.com/tickers
-	if interval != "" {
-		log.Info("Starting backup with interval", "interval", interval)
-
-		parentDir := filepath.Clean(backupConfig.Output)
-
-		if maxBackups < 1 {
-			log.Warn("maxBackups must be greater than 0. Setting to 1", "maxBackups", maxBackups)
-			maxBackups = 1
-		}
-
-		duration, err := time.ParseDuration(interval)
+	err := schedule.Validate()
+	if err != nil {
+		return err
+	}
+	if !schedule.IsEmpty() {
+		start := time.Now()
+		runs, err := schedule.parse(start)
 		if err != nil {
 			return err
 		}
+		log.Info("Starting backup with schedule", "schedule", schedule)
 
-		ticker := time.NewTicker(duration)
-		defer ticker.Stop()
-		var wg sync.WaitGroup
-
-		// Run backup on start
-		backupConfig.Output, err = rollingDirIfNotDryRun(backupConfig, maxBackups, parentDir)
+		parentDir := filepath.Clean(backupConfig.Output)
+		store, err := storage.New(backupConfig.Storage)
 		if err != nil {
 			return err
 		}
-		err = Backup(backupConfig)
-		if err != nil {
-			return err
+
+		if maxBackups < 1 {
+			log.Warn("maxBackups must be greater than 0. Setting to 1", "maxBackups", maxBackups)
+			maxBackups = 1
+		}
+		// maxBackups keeps the most recent backups, alongside the other rules of the retention policy
+		policy := backupConfig.Retention
+		policy.KeepLast = maxBackups
+
+		// Backups run one after another, so a backup that takes longer than the time until the next run delays it
+		next := runs.Next(start)
+		if schedule.Cron == "" {
+			// Run backup on start
+			next = start
 		}
-		errChan := make(chan error)
-		go func() {
-			defer close(errChan)
-			// The backup will not be concurrent if the backup process takes longer than the interval
-			for range ticker.C {
-				wg.Add(1)
-				backupConfig.Output, err = rollingDirIfNotDryRun(backupConfig, maxBackups, parentDir)
-				if err != nil {
-					errChan <- err
-					return
-				}
-				err = Backup(backupConfig)
-				if err != nil {
-					errChan <- err
-					return
-				}
-
-				wg.Done()
+		for {
+			if wait := time.Until(next); wait > 0 {
+				log.Info("Next backup scheduled", "at", next.Format(time.RFC3339))
+				time.Sleep(wait)
 			}
 
-		}()
-		wg.Wait()
-		// Handle errors from the goroutine
-		for err := range errChan {
+			backupConfig.Output, backupConfig.PruneError, err = rollingDirIfNotDryRun(backupConfig, store, policy, parentDir)
+			if err != nil {
+				return err
+			}
+			backupConfig.PreviousOutput, err = previousSnapshot(backupConfig, parentDir)
+			if err != nil {
+				return err
+			}
+			err = backupContinuing(backupConfig)
 			if err != nil {
 				return err
 			}
+			next = runs.Next(time.Now())
 		}
 	}
 	log.Info("Starting backup")
-	err := Backup(backupConfig)
+	err = Backup(backupConfig)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// Run Backup, only returning errors that should stop a continuous backup.
+// If some repositories failed to back up, the error is logged so the next backup still happens.
+func backupContinuing(config BackupConfig) error {
+	err := Backup(config)
+	if errors.Is(err, ErrIncompleteBackup) {
+		log.Error("Backup incomplete, continuing with the next backup", "err", err)
+		return nil
+	}
+	return err
+}
+
 // Only run utils.RollingDir if not in a dry run
-func rollingDirIfNotDryRun(config BackupConfig, maxBackups int, parentDir string) (string, error) {
+// If backups are uploaded to a storage, old backups are removed from it as well. Failing to do so doesn't stop the backup; the error is returned separately so the backup can report it.
+// When updating, the parent directory is reused so existing clones can be fetched into
+func rollingDirIfNotDryRun(config BackupConfig, store storage.Storage, policy utils.RetentionPolicy, parentDir string) (dir string, pruneErr error, err error) {
+	if config.Update {
+		log.Debug("Update mode - reusing the output directory instead of rolling directories", "path", parentDir)
+		return parentDir, nil, nil
+	}
 	if config.RunType != "dry-run" {
-		return utils.RollingDir(filepath.Clean(parentDir), maxBackups)
+		if store != nil {
+			pruneErr = pruneStorage(store, policy)
+			if pruneErr != nil {
+				log.Error("Failed to remove old backups from storage, continuing with the backup", "storage", store, "err", pruneErr)
+			}
+		}
+		dir, err = utils.RollingDir(filepath.Clean(parentDir), policy)
+		return dir, pruneErr, err
 	} else {
 		log.Debug("Dry run - not rolling directories")
 	}
-	return config.Output, nil
+	return config.Output, nil, nil
+}
+
+// Find the snapshot before config.Output that clones can be created from when deduplicating
+// Snapshots are only deduplicated when rolling directories, as updating fetches into the same clones instead
+func previousSnapshot(config BackupConfig, parentDir string) (string, error) {
+	if !config.Deduplicate || config.Update || config.RunType != "clone" {
+		return "", nil
+	}
+	previous, err := utils.LatestDir(parentDir, config.Output)
+	if err != nil {
+		return "", err
+	}
+	if previous != "" {
+		log.Debug("Deduplicating against previous snapshot", "path", previous)
+	}
+	return previous, nil
 }
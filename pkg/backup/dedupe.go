@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+// Directories (relative to the git directory) whose files are never modified once they are written, so they can be shared between snapshots with hard links.
+// Pack files and loose objects are named after their content, and Git LFS objects after their hash.
+var immutableGitDirs = []string{"objects/", "lfs/objects/"}
+
+// Check if a file of a clone, given its slash-separated path relative to the clone, is never modified once it is written.
+// bare is whether the clone is the git directory itself (a mirror) rather than a checkout with a `.git` directory.
+func isImmutableGitFile(relative string, bare bool) bool {
+	if !bare {
+		// Everything outside `.git` is the working tree, which checkouts modify, even if it has an `objects` directory
+		var inGitDir bool
+		relative, inGitDir = strings.CutPrefix(relative, ".git/")
+		if !inGitDir {
+			return false
+		}
+	}
+	// objects/info has files like `alternates` and `packs` that are rewritten
+	if strings.HasPrefix(relative, "objects/info/") {
+		return false
+	}
+	for _, dir := range immutableGitDirs {
+		if strings.HasPrefix(relative, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Create the clone at outputDirectory from the clone at the same path in the previous snapshot, then fetch what changed since.
+// Objects are hard linked, so they are only stored once across snapshots. Everything else, such as refs and the working tree, is copied (or reflinked), as it is modified in place.
+// Returns false without an error if there is no previous clone to start from.
+// If the clone can't be brought up to date, what was created is removed so it can be cloned from scratch instead.
+func seedFromPrevious(outputDirectory string, config BackupConfig, auth *http.BasicAuth) (bool, error) {
+	relative, err := filepath.Rel(config.Output, outputDirectory)
+	if err != nil {
+		return false, err
+	}
+	previous := filepath.Join(config.PreviousOutput, relative)
+	if _, err := git.PlainOpen(previous); err != nil {
+		return false, nil
+	}
+	if _, err := os.Stat(outputDirectory); err == nil {
+		// Something is already there, so don't risk mixing it with the previous clone
+		return false, nil
+	}
+
+	log.Debug("Reusing clone from previous snapshot", "path", outputDirectory, "previous", previous)
+	// Detected from the previous clone rather than the clone mode, in case it was changed since
+	_, err = os.Stat(filepath.Join(previous, git.GitDirName))
+	bare := err != nil
+	err = utils.LinkTree(previous, outputDirectory, func(relative string) bool {
+		return isImmutableGitFile(relative, bare)
+	})
+	if err == nil {
+		err = updateSeededClone(outputDirectory, config, auth)
+	}
+	if err != nil {
+		os.RemoveAll(outputDirectory)
+		return false, err
+	}
+	return true, nil
+}
+
+// Fetch into a clone copied from the previous snapshot so it matches a fresh clone.
+// For checkouts, the checked out branch and working tree are reset to the fetched branch, as fetching only updates the remote-tracking branches.
+func updateSeededClone(outputDirectory string, config BackupConfig, auth *http.BasicAuth) error {
+	repo, err := git.PlainOpen(outputDirectory)
+	if err != nil {
+		return err
+	}
+	err = config.Retry.Do(outputDirectory, func() error {
+		return fetchRepository(repo, auth)
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if config.CloneMode == "mirror" {
+		return nil
+	}
+
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return err
+	}
+	// If the branch was deleted upstream, this fails and the repository is cloned from scratch instead
+	remoteBranch, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, head.Target().Short()), true)
+	if err != nil {
+		return err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	err = worktree.Reset(&git.ResetOptions{Commit: remoteBranch.Hash(), Mode: git.HardReset})
+	if err != nil {
+		return err
+	}
+	if config.RecurseSubmodules > 0 {
+		submodules, err := worktree.Submodules()
+		if err != nil {
+			return err
+		}
+		return submodules.Update(&git.SubmoduleUpdateOptions{
+			Init:              true,
+			Auth:              auth,
+			RecurseSubmodules: git.SubmoduleRescursivity(config.RecurseSubmodules),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+func TestIsImmutableGitFile(t *testing.T) {
+	tests := []struct {
+		relative string
+		bare     bool
+		want     bool
+	}{
+		{".git/objects/4b/825dc642cb6eb9a060e54bf8d69288fbee4904", false, true},
+		{".git/objects/pack/pack-abc.pack", false, true},
+		{".git/objects/pack/pack-abc.idx", false, true},
+		{".git/lfs/objects/4d/7a/" + testOid, false, true},
+		{"objects/pack/pack-abc.pack", true, true},
+		{"objects/4b/825dc642cb6eb9a060e54bf8d69288fbee4904", true, true},
+		{"lfs/objects/4d/7a/" + testOid, true, true},
+		{".git/objects/info/packs", false, false},
+		{".git/objects/info/alternates", false, false},
+		{"objects/info/packs", true, false},
+		{".git/index", false, false},
+		{".git/HEAD", false, false},
+		{".git/config", false, false},
+		{".git/packed-refs", false, false},
+		{".git/refs/heads/main", false, false},
+		{".git/refs/tags/v1", false, false},
+		{".git/shallow", false, false},
+		{".git/lfs/tmp/download", false, false},
+		{"HEAD", true, false},
+		{"config", true, false},
+		{"packed-refs", true, false},
+		{"refs/heads/main", true, false},
+		// The working tree of a checkout is modified by checkouts, even where it looks like a git directory
+		{"objects/pack/pack-abc.pack", false, false},
+		{"lfs/objects/data.bin", false, false},
+		{"src/objects/main.go", false, false},
+		{"README.md", false, false},
+	}
+	for _, test := range tests {
+		if got := isImmutableGitFile(test.relative, test.bare); got != test.want {
+			t.Errorf("isImmutableGitFile(%q, %t) = %t, want %t", test.relative, test.bare, got, test.want)
+		}
+	}
+}
+
+// Get the slash-separated paths of the regular files under dir
+func testFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		relative, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(relative))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestLinkClone(t *testing.T) {
+	previous := filepath.Join(t.TempDir(), "acme", "api")
+	repo := newTestRepository(t, previous)
+	if err := os.WriteFile(filepath.Join(previous, "README.md"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add("README.md"); err != nil {
+		t.Fatal(err)
+	}
+	first := testCommit(t, repo, "first")
+	setTestRef(t, repo, "refs/tags/v1", first)
+	// Clones have both packs and loose objects
+	if err := repo.RepackObjects(&git.RepackConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	second := testCommit(t, repo, "second", first)
+	packer, ok := repo.Storer.(interface{ PackRefs() error })
+	if !ok {
+		t.Fatal("storage can't pack refs")
+	}
+	if err := packer.PackRefs(); err != nil {
+		t.Fatal(err)
+	}
+	setTestRef(t, repo, "refs/heads/main", second)
+	if err := os.WriteFile(filepath.Join(previous, ".git", "objects", "info", "packs"), []byte("P pack.pack\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	next := filepath.Join(t.TempDir(), "acme", "api")
+	err = utils.LinkTree(previous, next, func(relative string) bool {
+		return isImmutableGitFile(relative, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := testFiles(t, previous)
+	var packs, looseObjects int
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(previous, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nextInfo, err := os.Stat(filepath.Join(next, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		linked := os.SameFile(info, nextInfo)
+		switch {
+		case strings.HasSuffix(file, ".pack") || strings.HasSuffix(file, ".idx"):
+			packs++
+			if !linked {
+				t.Errorf("%s was copied, want it hard linked", file)
+			}
+		case strings.HasPrefix(file, ".git/objects/") && !strings.HasPrefix(file, ".git/objects/info/"):
+			looseObjects++
+			if !linked {
+				t.Errorf("%s was copied, want it hard linked", file)
+			}
+		default:
+			if linked {
+				t.Errorf("%s was hard linked, want it copied", file)
+			}
+		}
+	}
+	if packs < 2 || looseObjects == 0 {
+		t.Fatalf("expected packs and loose objects, got %d pack files and %d loose objects in %q", packs, looseObjects, files)
+	}
+	for _, mutable := range []string{".git/index", ".git/HEAD", ".git/config", ".git/packed-refs", ".git/refs/heads/main", ".git/objects/info/packs", "README.md"} {
+		if !slices.Contains(files, mutable) {
+			t.Errorf("expected the clone to have %s", mutable)
+		}
+	}
+
+	// Writing to the new snapshot, like a fetch does, leaves the previous one as it was
+	before := testRefs(t, repo)
+	configBefore, err := os.ReadFile(filepath.Join(previous, ".git", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextRepo, err := git.PlainOpen(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third := testCommit(t, nextRepo, "third", second)
+	setTestRef(t, nextRepo, "refs/tags/v1", third)
+	setTestRef(t, nextRepo, "refs/heads/feature", third)
+	if err := nextRepo.Storer.(interface{ PackRefs() error }).PackRefs(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = nextRepo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"https://github.com/acme/api.git"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(next, "README.md"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := git.PlainOpen(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := testRefs(t, reopened); !slices.Equal(after, before) {
+		t.Errorf("refs of the previous snapshot changed from %q to %q", before, after)
+	}
+	if configAfter, _ := os.ReadFile(filepath.Join(previous, ".git", "config")); string(configAfter) != string(configBefore) {
+		t.Errorf("config of the previous snapshot changed from %q to %q", configBefore, configAfter)
+	}
+	if readme, _ := os.ReadFile(filepath.Join(previous, "README.md")); string(readme) != "hello" {
+		t.Errorf("README.md of the previous snapshot changed to %q", readme)
+	}
+	if _, err := reopened.CommitObject(third); err == nil {
+		t.Error("a commit made in the new snapshot is in the previous one")
+	}
+	if problems := checkObjects(reopened); len(problems) > 0 {
+		t.Errorf("previous snapshot is no longer intact: %q", problems)
+	}
+}
@@ -0,0 +1,386 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"filippo.io/age"
+	"github.com/charmbracelet/log"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Kinds of RefChange
+const (
+	RefCreated = "created"
+	RefDeleted = "deleted"
+	// The ref moved forward, or a tag was moved to a commit that contains the old one
+	RefMoved = "moved"
+	// The old commit is no longer an ancestor of the new one, so history was rewritten
+	RefForcePushed = "force-pushed"
+	// A tag points to something else. Tags aren't expected to move at all, so this is a rewrite whichever way it moved.
+	RefRetagged = "retagged"
+)
+
+// SnapshotDiff is what changed between two backups
+type SnapshotDiff struct {
+	From    string              `json:"from"`
+	To      string              `json:"to"`
+	Added   []string            `json:"added"`
+	Removed []string            `json:"removed"`
+	Renamed []RepositoryRename  `json:"renamed"`
+	Changed []RepositoryChanges `json:"changed"`
+}
+
+// RepositoryRename is a repository that was removed and added under another name with the same history
+type RepositoryRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RepositoryChanges is what changed in a repository that is in both backups
+type RepositoryChanges struct {
+	Name string `json:"name"`
+	// Set if the default branch changed, as `old -> new`
+	DefaultBranch string      `json:"default_branch,omitempty"`
+	Refs          []RefChange `json:"refs"`
+}
+
+// RefChange is a branch or tag that was created, deleted, moved, force-pushed, or retagged
+type RefChange struct {
+	Ref    string `json:"ref"`
+	Change string `json:"change"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+// Rewrites returns every ref whose history was rewritten (force-pushed branches and retagged tags), as `repository ref`
+func (d SnapshotDiff) Rewrites() []string {
+	var rewritten []string
+	for _, repo := range d.Changed {
+		for _, ref := range repo.Refs {
+			if ref.Change == RefForcePushed || ref.Change == RefRetagged {
+				rewritten = append(rewritten, repo.Name+" "+ref.Ref)
+			}
+		}
+	}
+	return rewritten
+}
+
+// A backup opened for diffing
+type diffSide struct {
+	dir        string
+	entries    map[string]ManifestEntry
+	identities []age.Identity
+}
+
+// Open a backup and get the refs of each repository in it.
+// Refs come from the manifest, or from the clones for backups without one.
+func openDiffSide(snapshot string, identities []age.Identity) (*diffSide, func(), error) {
+	dir, cleanup, err := openSnapshot(snapshot, identities)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := snapshotRepositories(dir)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	side := &diffSide{dir: dir, entries: make(map[string]ManifestEntry), identities: identities}
+	for _, entry := range entries {
+		if entry.Status == StatusFailed {
+			log.Warn("Repository failed to clone in backup, ignoring it", "snapshot", snapshot, "repository", entry.Name)
+			continue
+		}
+		if entry.Refs == nil {
+			entry.Refs, err = side.readRefs(entry.Path)
+			if err != nil {
+				cleanup()
+				return nil, nil, fmt.Errorf("failed to read refs of %s: %w", entry.Name, err)
+			}
+		}
+		side.entries[entry.Name] = entry
+	}
+	return side, cleanup, nil
+}
+
+// Read the refs of a clone in the backup, which may be archived on its own
+func (s *diffSide) readRefs(path string) (map[string]string, error) {
+	dir, cleanup, err := openClone(s.dir, path, s.identities)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	return readRefs(dir)
+}
+
+// Open the clone of a repository to check ancestry in
+func (s *diffSide) open(name string) (*git.Repository, func(), error) {
+	dir, cleanup, err := openClone(s.dir, s.entries[name].Path, s.identities)
+	if err != nil {
+		return nil, nil, err
+	}
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return repo, cleanup, nil
+}
+
+// DiffSnapshots compares two backups (directories or archives of them), from the older one to the newer one.
+// Only branches and tags are compared. Repositories that were removed and added under another name with the same history are reported as renamed.
+func DiffSnapshots(from string, to string, identities []age.Identity) (*SnapshotDiff, error) {
+	fromSide, cleanupFrom, err := openDiffSide(from, identities)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupFrom()
+	toSide, cleanupTo, err := openDiffSide(to, identities)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupTo()
+
+	diff := &SnapshotDiff{From: from, To: to, Added: []string{}, Removed: []string{}, Renamed: []RepositoryRename{}, Changed: []RepositoryChanges{}}
+	var added, removed []string
+	for name := range toSide.entries {
+		if _, ok := fromSide.entries[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	for name := range fromSide.entries {
+		if _, ok := toSide.entries[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+
+	// A renamed repository is removed under its old name and added under the new one
+	for _, oldName := range removed {
+		newName, err := findRename(fromSide.entries[oldName], added, toSide)
+		if err != nil {
+			return nil, err
+		}
+		if newName == "" {
+			diff.Removed = append(diff.Removed, oldName)
+			continue
+		}
+		diff.Renamed = append(diff.Renamed, RepositoryRename{From: oldName, To: newName})
+		added = slices.DeleteFunc(added, func(name string) bool { return name == newName })
+		changes, err := diffRepository(newName, fromSide.entries[oldName], toSide)
+		if err != nil {
+			return nil, err
+		}
+		if changes.DefaultBranch != "" || len(changes.Refs) > 0 {
+			diff.Changed = append(diff.Changed, changes)
+		}
+	}
+	diff.Added = append(diff.Added, added...)
+
+	var names []string
+	for name := range fromSide.entries {
+		if _, ok := toSide.entries[name]; ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		changes, err := diffRepository(name, fromSide.entries[name], toSide)
+		if err != nil {
+			return nil, err
+		}
+		if changes.DefaultBranch != "" || len(changes.Refs) > 0 {
+			diff.Changed = append(diff.Changed, changes)
+		}
+	}
+	slices.SortFunc(diff.Changed, func(a, b RepositoryChanges) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return diff, nil
+}
+
+// Find the repository a removed repository was renamed to among the added repositories.
+// A repository whose default branch is the same as the removed repository's is preferred. Otherwise, the one whose default branch contains it is, as the repository may have been pushed to after it was renamed.
+// If several repositories qualify equally, such as new forks or mirrors of the same repository, none of them is picked. Returns an empty string if there is no single match.
+func findRename(old ManifestEntry, added []string, toSide *diffSide) (string, error) {
+	oldHead, ok := old.Refs["HEAD"]
+	if !ok {
+		return "", nil
+	}
+	var same, descendants []string
+	for _, name := range added {
+		newHead, ok := toSide.entries[name].Refs["HEAD"]
+		if !ok {
+			continue
+		}
+		if newHead == oldHead {
+			same = append(same, name)
+			continue
+		}
+		// Only needed if there is no exact match
+		if len(same) > 0 {
+			continue
+		}
+		repo, cleanup, err := toSide.open(name)
+		if err != nil {
+			return "", err
+		}
+		ancestor, err := isAncestor(repo, oldHead, newHead)
+		cleanup()
+		if err != nil {
+			return "", err
+		}
+		if ancestor {
+			descendants = append(descendants, name)
+		}
+	}
+	switch {
+	case len(same) == 1:
+		return same[0], nil
+	case len(same) == 0 && len(descendants) == 1:
+		return descendants[0], nil
+	case len(same) > 1 || len(descendants) > 1:
+		log.Warn("Several added repositories have the history of a removed repository, so it isn't treated as renamed", "repository", old.Name, "candidates", append(same, descendants...))
+	}
+	return "", nil
+}
+
+// Compare the branches and tags of a repository in the older backup to the repository called name in the newer one
+func diffRepository(name string, old ManifestEntry, toSide *diffSide) (RepositoryChanges, error) {
+	current := toSide.entries[name]
+	changes := RepositoryChanges{Name: name, Refs: []RefChange{}}
+	if old.DefaultBranch != "" && current.DefaultBranch != "" && old.DefaultBranch != current.DefaultBranch {
+		changes.DefaultBranch = old.DefaultBranch + " -> " + current.DefaultBranch
+	}
+
+	oldRefs, newRefs := branchesAndTags(old.Refs), branchesAndTags(current.Refs)
+	var repo *git.Repository
+	for ref, newHash := range newRefs {
+		oldHash, ok := oldRefs[ref]
+		if !ok {
+			changes.Refs = append(changes.Refs, RefChange{Ref: ref, Change: RefCreated, To: newHash})
+			continue
+		}
+		if oldHash == newHash {
+			continue
+		}
+		if plumbing.ReferenceName(ref).IsTag() {
+			changes.Refs = append(changes.Refs, RefChange{Ref: ref, Change: RefRetagged, From: oldHash, To: newHash})
+			continue
+		}
+		// Only open the clone once something moved, as most repositories don't change between backups
+		if repo == nil {
+			var cleanup func()
+			var err error
+			repo, cleanup, err = toSide.open(name)
+			if err != nil {
+				return changes, err
+			}
+			defer cleanup()
+		}
+		change := RefMoved
+		ancestor, err := isAncestor(repo, oldHash, newHash)
+		if err != nil {
+			return changes, fmt.Errorf("failed to check ancestry of %s in %s: %w", ref, name, err)
+		}
+		if !ancestor {
+			change = RefForcePushed
+		}
+		changes.Refs = append(changes.Refs, RefChange{Ref: ref, Change: change, From: oldHash, To: newHash})
+	}
+	for ref, oldHash := range oldRefs {
+		if _, ok := newRefs[ref]; !ok {
+			changes.Refs = append(changes.Refs, RefChange{Ref: ref, Change: RefDeleted, From: oldHash})
+		}
+	}
+	slices.SortFunc(changes.Refs, func(a, b RefChange) int {
+		return strings.Compare(a.Ref, b.Ref)
+	})
+	return changes, nil
+}
+
+// Get the branches and tags from the refs of a clone.
+// Checkouts only have the default branch as a local branch, so their remote-tracking branches count as branches, and win over local branches as they are what was fetched last.
+func branchesAndTags(refs map[string]string) map[string]string {
+	found := make(map[string]string)
+	remotePrefix := "refs/remotes/" + git.DefaultRemoteName + "/"
+	for name, hash := range refs {
+		ref := plumbing.ReferenceName(name)
+		if (ref.IsBranch() || ref.IsTag()) && found[name] == "" {
+			found[name] = hash
+		} else if branch, ok := strings.CutPrefix(name, remotePrefix); ok && branch != "HEAD" {
+			found[plumbing.NewBranchReferenceName(branch).String()] = hash
+		}
+	}
+	return found
+}
+
+// Check if the commit oldHash points to (peeling tags) is an ancestor of, or the same as, the one newHash points to.
+// If oldHash isn't in the repository at all, it can't be an ancestor of anything in it.
+func isAncestor(repo *git.Repository, oldHash string, newHash string) (bool, error) {
+	newCommit, err := peelToCommit(repo, plumbing.NewHash(newHash))
+	if err != nil {
+		return false, err
+	}
+	oldCommit, err := peelToCommit(repo, plumbing.NewHash(oldHash))
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return oldCommit.IsAncestor(newCommit)
+}
+
+// PrintDiff prints a diff as a human-readable report
+func PrintDiff(w io.Writer, diff *SnapshotDiff) error {
+	fmt.Fprintf(w, "From %s\nTo   %s\n\n", diff.From, diff.To)
+	if len(diff.Added)+len(diff.Removed)+len(diff.Renamed)+len(diff.Changed) == 0 {
+		fmt.Fprintln(w, "No changes")
+		return nil
+	}
+	for _, name := range diff.Added {
+		fmt.Fprintf(w, "+ %s\n", name)
+	}
+	for _, name := range diff.Removed {
+		fmt.Fprintf(w, "- %s\n", name)
+	}
+	for _, rename := range diff.Renamed {
+		fmt.Fprintf(w, "~ %s -> %s\n", rename.From, rename.To)
+	}
+	if len(diff.Added)+len(diff.Removed)+len(diff.Renamed) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "REPOSITORY\tREF\tCHANGE\tFROM\tTO")
+	for _, repo := range diff.Changed {
+		if repo.DefaultBranch != "" {
+			old, current, _ := strings.Cut(repo.DefaultBranch, " -> ")
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", repo.Name, "default branch", "changed", old, current)
+		}
+		for _, ref := range repo.Refs {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", repo.Name, ref.Ref, ref.Change, shortHash(ref.From), shortHash(ref.To))
+		}
+	}
+	err := table.Flush()
+	if rewritten := diff.Rewrites(); len(rewritten) > 0 {
+		fmt.Fprintf(w, "\n%d refs were force-pushed or retagged, rewriting history\n", len(rewritten))
+	}
+	return err
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	if hash == "" {
+		return "-"
+	}
+	return hash
+}
@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// A line of history in a test repository. Commits are identified by their message, and the same messages and parents give the same hashes in every repository.
+type testHistory struct {
+	repo    *git.Repository
+	commits map[string]plumbing.Hash
+}
+
+func newTestHistory(t *testing.T, dir string) *testHistory {
+	t.Helper()
+	return &testHistory{repo: newTestRepository(t, dir), commits: make(map[string]plumbing.Hash)}
+}
+
+// Commit on top of parent, or with no parent if it is empty
+func (h *testHistory) commit(t *testing.T, message string, parent string) *testHistory {
+	t.Helper()
+	var parents []plumbing.Hash
+	if parent != "" {
+		parents = append(parents, h.commits[parent])
+	}
+	h.commits[message] = testCommit(t, h.repo, message, parents...)
+	return h
+}
+
+// Point refs to commits, as `ref commit` pairs
+func (h *testHistory) refs(t *testing.T, pairs ...string) *testHistory {
+	t.Helper()
+	for i := 0; i < len(pairs); i += 2 {
+		setTestRef(t, h.repo, pairs[i], h.commits[pairs[i+1]])
+	}
+	return h
+}
+
+// Write a manifest for every `<owner>/<repository>` clone in a backup directory
+func writeTestManifest(t *testing.T, dir string) {
+	t.Helper()
+	manifest := &Manifest{}
+	owners, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, owner := range owners {
+		repos, err := os.ReadDir(filepath.Join(dir, owner.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, repo := range repos {
+			name := owner.Name() + "/" + repo.Name()
+			refs, err := readRefs(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifest.Repositories = append(manifest.Repositories, ManifestEntry{Name: name, Path: name, Refs: refs, Status: StatusOK, DefaultBranch: "main"})
+		}
+	}
+	if err := writeJSON(filepath.Join(dir, ManifestFile), manifest); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	from, to := t.TempDir(), t.TempDir()
+
+	newTestHistory(t, filepath.Join(from, "acme", "api")).
+		commit(t, "first", "").
+		commit(t, "second", "first").
+		refs(t, "refs/heads/feature", "first", "refs/tags/v1", "first", "refs/tags/v2", "first", "refs/tags/old", "first")
+	newTestHistory(t, filepath.Join(to, "acme", "api")).
+		commit(t, "first", "").
+		commit(t, "second", "first").
+		// main is reset to first and committed to again
+		commit(t, "rewritten", "first").
+		refs(t, "refs/heads/main", "rewritten", "refs/heads/feature", "second", "refs/tags/v1", "first", "refs/tags/v2", "second", "refs/tags/v3", "rewritten")
+
+	// Renamed and pushed to afterwards
+	newTestHistory(t, filepath.Join(from, "acme", "old")).commit(t, "old", "")
+	newTestHistory(t, filepath.Join(to, "acme", "new")).commit(t, "old", "").commit(t, "after rename", "old")
+
+	// The repository with the same history is preferred over one that was pushed to since
+	newTestHistory(t, filepath.Join(from, "acme", "exact-old")).commit(t, "exact", "")
+	newTestHistory(t, filepath.Join(to, "acme", "exact-new")).commit(t, "exact", "")
+	newTestHistory(t, filepath.Join(to, "acme", "exact-descendant")).commit(t, "exact", "").commit(t, "descendant", "exact")
+
+	// Forks with the same history aren't renames, as it isn't clear which one it would be
+	newTestHistory(t, filepath.Join(from, "acme", "forked")).commit(t, "forked", "")
+	newTestHistory(t, filepath.Join(to, "alice", "forked")).commit(t, "forked", "")
+	newTestHistory(t, filepath.Join(to, "bob", "forked")).commit(t, "forked", "")
+
+	newTestHistory(t, filepath.Join(from, "acme", "gone")).commit(t, "gone", "")
+	newTestHistory(t, filepath.Join(to, "acme", "fresh")).commit(t, "fresh", "")
+
+	writeTestManifest(t, from)
+	writeTestManifest(t, to)
+
+	diff, err := DiffSnapshots(from, to, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"acme/exact-descendant", "acme/fresh", "alice/forked", "bob/forked"}; !slices.Equal(diff.Added, want) {
+		t.Errorf("added: got %v, want %v", diff.Added, want)
+	}
+	if want := []string{"acme/forked", "acme/gone"}; !slices.Equal(diff.Removed, want) {
+		t.Errorf("removed: got %v, want %v", diff.Removed, want)
+	}
+	wantRenamed := []RepositoryRename{{From: "acme/exact-old", To: "acme/exact-new"}, {From: "acme/old", To: "acme/new"}}
+	if !slices.Equal(diff.Renamed, wantRenamed) {
+		t.Errorf("renamed: got %v, want %v", diff.Renamed, wantRenamed)
+	}
+
+	var changes []string
+	for _, repo := range diff.Changed {
+		for _, ref := range repo.Refs {
+			changes = append(changes, repo.Name+" "+ref.Ref+" "+ref.Change)
+		}
+	}
+	wantChanges := []string{
+		"acme/api refs/heads/feature moved",
+		"acme/api refs/heads/main force-pushed",
+		"acme/api refs/tags/old deleted",
+		"acme/api refs/tags/v2 retagged",
+		"acme/api refs/tags/v3 created",
+		"acme/new refs/heads/main moved",
+	}
+	if !slices.Equal(changes, wantChanges) {
+		t.Errorf("changes: got %q, want %q", changes, wantChanges)
+	}
+	if want := []string{"acme/api refs/heads/main", "acme/api refs/tags/v2"}; !slices.Equal(diff.Rewrites(), want) {
+		t.Errorf("rewrites: got %v, want %v", diff.Rewrites(), want)
+	}
+}
+
+func TestBranchesAndTags(t *testing.T) {
+	refs := map[string]string{
+		"HEAD":                        "a",
+		"refs/heads/main":             "old",
+		"refs/heads/local":            "b",
+		"refs/remotes/origin/HEAD":    "c",
+		"refs/remotes/origin/main":    "new",
+		"refs/remotes/origin/feature": "d",
+		"refs/remotes/upstream/main":  "e",
+		"refs/tags/v1":                "f",
+		"refs/pull/1/head":            "g",
+		"refs/notes/commits":          "h",
+	}
+	want := map[string]string{
+		"refs/heads/main":    "new",
+		"refs/heads/local":   "b",
+		"refs/heads/feature": "d",
+		"refs/tags/v1":       "f",
+	}
+	// Map iteration order is random, so the remote-tracking branch has to win however the refs are visited
+	for range 20 {
+		got := branchesAndTags(refs)
+		if len(got) != len(want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for ref, hash := range want {
+			if got[ref] != hash {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		}
+	}
+}
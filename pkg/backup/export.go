@@ -0,0 +1,47 @@
+package backup
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-github/v63/github"
+)
+
+// Get the directory that JSON exports (issues, pull requests, etc.) for a repository are written to.
+// It sits next to the clones in a directory that can't collide with a GitHub username, as usernames can't contain underscores.
+func metadataDirectory(output string, repo *github.Repository) string {
+	return filepath.Join(output, "_metadata", repo.GetFullName())
+}
+
+// Call list until there are no more pages, returning every item.
+// list should pass opt (usually the ListOptions embedded in the options struct) to the go-github method so the page can be advanced.
+// https://github.com/google/go-github?tab=readme-ov-file#pagination
+func listAll[T any](opt *github.ListOptions, list func() ([]T, *github.Response, error)) ([]T, error) {
+	var all []T
+	for {
+		items, resp, err := list()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return all, nil
+}
+
+// Marshal v to indented JSON and write it to path, creating any parent directories.
+func writeJSON(path string, v any) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
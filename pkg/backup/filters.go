@@ -0,0 +1,157 @@
+package backup
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/go-github/v63/github"
+)
+
+// RepositoryFilter decides which of the fetched repositories are backed up.
+// The zero value keeps every repository. Lists that are empty don't filter anything.
+type RepositoryFilter struct {
+	// Forks can be `include` (default), `exclude`, or `only`
+	Forks string
+	// Archived can be `include` (default), `exclude`, or `only`
+	Archived string
+	// Visibility keeps repositories with one of these visibilities: `public`, `private`, or `internal`
+	Visibility []string
+	// Owners keeps repositories owned by one of these users or organizations
+	Owners        []string
+	ExcludeOwners []string
+	// Topics keeps repositories with at least one of these topics
+	Topics        []string
+	ExcludeTopics []string
+	// Languages keeps repositories whose primary language is one of these
+	Languages        []string
+	ExcludeLanguages []string
+	// MinSize and MaxSize are in bytes. 0 means no limit.
+	// GitHub reports sizes in kilobytes, and the size is only updated periodically, so this is approximate.
+	MinSize uint64
+	MaxSize uint64
+	// Names keeps repositories whose full name (`owner/repository`) matches one of these patterns.
+	// Patterns are globs, like `owner/*`, unless they are wrapped in slashes, like `/^owner\/.*-backup$/`, in which case they are regular expressions.
+	Names        []string
+	ExcludeNames []string
+}
+
+// Remove the repositories that don't pass the filter.
+func FilterRepositories(repositories []*github.Repository, filter RepositoryFilter) ([]*github.Repository, error) {
+	for _, mode := range []string{filter.Forks, filter.Archived} {
+		if mode != "" && mode != "include" && mode != "exclude" && mode != "only" {
+			return nil, fmt.Errorf("invalid filter mode: %s; must be one of `include`, `exclude`, or `only`", mode)
+		}
+	}
+	names, err := compileNamePatterns(filter.Names)
+	if err != nil {
+		return nil, err
+	}
+	excludeNames, err := compileNamePatterns(filter.ExcludeNames)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []*github.Repository
+	for _, repo := range repositories {
+		reason := ""
+		switch {
+		case !matchesMode(filter.Forks, repo.GetFork()):
+			reason = "fork"
+		case !matchesMode(filter.Archived, repo.GetArchived()):
+			reason = "archived"
+		case len(filter.Visibility) > 0 && !containsFold(filter.Visibility, repositoryVisibility(repo)):
+			reason = "visibility"
+		case len(filter.Owners) > 0 && !containsFold(filter.Owners, repo.GetOwner().GetLogin()):
+			reason = "owner"
+		case containsFold(filter.ExcludeOwners, repo.GetOwner().GetLogin()):
+			reason = "owner"
+		case len(filter.Topics) > 0 && !slices.ContainsFunc(repo.Topics, func(topic string) bool { return containsFold(filter.Topics, topic) }):
+			reason = "topic"
+		case slices.ContainsFunc(repo.Topics, func(topic string) bool { return containsFold(filter.ExcludeTopics, topic) }):
+			reason = "topic"
+		case len(filter.Languages) > 0 && !containsFold(filter.Languages, repo.GetLanguage()):
+			reason = "language"
+		case containsFold(filter.ExcludeLanguages, repo.GetLanguage()):
+			reason = "language"
+		case filter.MinSize > 0 && uint64(repo.GetSize())*1024 < filter.MinSize:
+			reason = "size"
+		case filter.MaxSize > 0 && uint64(repo.GetSize())*1024 > filter.MaxSize:
+			reason = "size"
+		case len(names) > 0 && !matchesAny(names, repo.GetFullName()):
+			reason = "name"
+		case matchesAny(excludeNames, repo.GetFullName()):
+			reason = "name"
+		}
+		if reason != "" {
+			log.Debug("Filtered out repository", "repository", repo.GetFullName(), "reason", reason)
+			continue
+		}
+		filtered = append(filtered, repo)
+	}
+	return filtered, nil
+}
+
+// Check a boolean property against an `include`, `exclude`, or `only` mode
+func matchesMode(mode string, value bool) bool {
+	switch mode {
+	case "exclude":
+		return !value
+	case "only":
+		return value
+	default:
+		return true
+	}
+}
+
+// Get the visibility of a repository, falling back to the private flag as visibility isn't always returned
+func repositoryVisibility(repo *github.Repository) string {
+	if repo.GetVisibility() != "" {
+		return repo.GetVisibility()
+	}
+	if repo.GetPrivate() {
+		return "private"
+	}
+	return "public"
+}
+
+// Case-insensitive slices.Contains, as GitHub names, topics, and languages are case-insensitive
+func containsFold(list []string, value string) bool {
+	return slices.ContainsFunc(list, func(item string) bool {
+		return strings.EqualFold(item, value)
+	})
+}
+
+// Turn name patterns into matchers. Globs are matched case-insensitively.
+func compileNamePatterns(patterns []string) ([]func(string) bool, error) {
+	var matchers []func(string) bool
+	for _, pattern := range patterns {
+		if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid name pattern %s: %w", pattern, err)
+			}
+			matchers = append(matchers, re.MatchString)
+			continue
+		}
+		glob := strings.ToLower(pattern)
+		// Check the pattern is valid now instead of ignoring the error on every match
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern %s: %w", pattern, err)
+		}
+		matchers = append(matchers, func(name string) bool {
+			matched, _ := path.Match(glob, strings.ToLower(name))
+			return matched
+		})
+	}
+	return matchers, nil
+}
+
+func matchesAny(matchers []func(string) bool, name string) bool {
+	return slices.ContainsFunc(matchers, func(match func(string) bool) bool {
+		return match(name)
+	})
+}
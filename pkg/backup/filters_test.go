@@ -0,0 +1,151 @@
+package backup
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-github/v63/github"
+)
+
+func TestFilterRepositories(t *testing.T) {
+	repositories := []*github.Repository{
+		{
+			FullName: github.String("alice/app"),
+			Owner:    &github.User{Login: github.String("alice")},
+			Language: github.String("Go"),
+			Topics:   []string{"cli", "backup"},
+			Size:     github.Int(100),
+		},
+		{
+			FullName: github.String("alice/app-fork"),
+			Owner:    &github.User{Login: github.String("alice")},
+			Fork:     github.Bool(true),
+			Language: github.String("Python"),
+			Size:     github.Int(5000),
+		},
+		{
+			FullName: github.String("Acme/old-archive"),
+			Owner:    &github.User{Login: github.String("Acme")},
+			Archived: github.Bool(true),
+			Private:  github.Bool(true),
+			Topics:   []string{"legacy"},
+		},
+		{
+			FullName:   github.String("acme/internal-tools"),
+			Owner:      &github.User{Login: github.String("acme")},
+			Visibility: github.String("internal"),
+			Language:   github.String("go"),
+			Size:       github.Int(2048),
+		},
+	}
+
+	tests := []struct {
+		name   string
+		filter RepositoryFilter
+		want   []string
+	}{
+		{
+			name:   "zero value keeps everything",
+			filter: RepositoryFilter{},
+			want:   []string{"alice/app", "alice/app-fork", "Acme/old-archive", "acme/internal-tools"},
+		},
+		{
+			name:   "exclude forks",
+			filter: RepositoryFilter{Forks: "exclude"},
+			want:   []string{"alice/app", "Acme/old-archive", "acme/internal-tools"},
+		},
+		{
+			name:   "only forks",
+			filter: RepositoryFilter{Forks: "only"},
+			want:   []string{"alice/app-fork"},
+		},
+		{
+			name:   "only archived",
+			filter: RepositoryFilter{Archived: "only"},
+			want:   []string{"Acme/old-archive"},
+		},
+		{
+			name:   "visibility falls back to the private flag",
+			filter: RepositoryFilter{Visibility: []string{"private", "internal"}},
+			want:   []string{"Acme/old-archive", "acme/internal-tools"},
+		},
+		{
+			name:   "owners are case-insensitive",
+			filter: RepositoryFilter{Owners: []string{"ACME"}},
+			want:   []string{"Acme/old-archive", "acme/internal-tools"},
+		},
+		{
+			name:   "exclude owners",
+			filter: RepositoryFilter{ExcludeOwners: []string{"acme"}},
+			want:   []string{"alice/app", "alice/app-fork"},
+		},
+		{
+			name:   "topics",
+			filter: RepositoryFilter{Topics: []string{"CLI", "legacy"}},
+			want:   []string{"alice/app", "Acme/old-archive"},
+		},
+		{
+			name:   "exclude topics",
+			filter: RepositoryFilter{ExcludeTopics: []string{"legacy"}},
+			want:   []string{"alice/app", "alice/app-fork", "acme/internal-tools"},
+		},
+		{
+			name:   "languages are case-insensitive",
+			filter: RepositoryFilter{Languages: []string{"Go"}},
+			want:   []string{"alice/app", "acme/internal-tools"},
+		},
+		{
+			name:   "exclude languages",
+			filter: RepositoryFilter{ExcludeLanguages: []string{"python"}},
+			want:   []string{"alice/app", "Acme/old-archive", "acme/internal-tools"},
+		},
+		{
+			name:   "sizes are in kilobytes",
+			filter: RepositoryFilter{MinSize: 1024 * 1024, MaxSize: 4 * 1024 * 1024},
+			want:   []string{"acme/internal-tools"},
+		},
+		{
+			name:   "name globs are case-insensitive",
+			filter: RepositoryFilter{Names: []string{"ACME/*"}},
+			want:   []string{"Acme/old-archive", "acme/internal-tools"},
+		},
+		{
+			name:   "name regular expressions",
+			filter: RepositoryFilter{Names: []string{`/^alice\/app$/`}},
+			want:   []string{"alice/app"},
+		},
+		{
+			name:   "exclude names",
+			filter: RepositoryFilter{ExcludeNames: []string{"*/app*", `/archive$/`}},
+			want:   []string{"acme/internal-tools"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filtered, err := FilterRepositories(repositories, test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, repo := range filtered {
+				got = append(got, repo.GetFullName())
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterRepositoriesInvalid(t *testing.T) {
+	for _, filter := range []RepositoryFilter{
+		{Forks: "sometimes"},
+		{Archived: "no"},
+		{Names: []string{"[owner/*"}},
+		{ExcludeNames: []string{"/(/"}},
+	} {
+		if _, err := FilterRepositories(nil, filter); err == nil {
+			t.Errorf("expected an error for %+v", filter)
+		}
+	}
+}
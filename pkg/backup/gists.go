@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/go-github/v63/github"
+)
+
+// A gist along with its comments, written next to the gist's clone as `<id>.json`
+type GistExport struct {
+	Gist     *github.Gist          `json:"gist"`
+	Comments []*github.GistComment `json:"comments"`
+}
+
+// Get the gists of each user. If usernames is empty, the gists of the authenticated user are fetched.
+// The authenticated user's secret gists are included whenever the authenticated user is fetched, either implicitly or by username.
+// If getStarred is true, the gists starred by the authenticated user are fetched as well.
+// Gists are deduplicated by ID.
+func GetGists(client *github.Client, usernames []string, getStarred bool) ([]*github.Gist, error) {
+	ctx := context.Background()
+
+	// If the username is an empty string, Gists.List will return the authenticated user's gists, including secret ones
+	toFetch := []string{""}
+	if len(usernames) > 0 {
+		authenticated, _, err := client.Users.Get(ctx, "")
+		if err != nil {
+			log.Debug("Failed to get the authenticated user, secret gists won't be fetched", "error", err)
+		}
+		toFetch = nil
+		for _, username := range usernames {
+			if authenticated != nil && username == authenticated.GetLogin() {
+				username = ""
+			}
+			toFetch = append(toFetch, username)
+		}
+	}
+
+	var gists []*github.Gist
+	for _, username := range toFetch {
+		opt := &github.GistListOptions{
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+		userGists, err := listAll(&opt.ListOptions, func() ([]*github.Gist, *github.Response, error) {
+			return client.Gists.List(ctx, username, opt)
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Debug("Fetched user's gists", "count", len(userGists), "username", username)
+		gists = append(gists, userGists...)
+	}
+
+	if getStarred {
+		opt := &github.GistListOptions{
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+		starredGists, err := listAll(&opt.ListOptions, func() ([]*github.Gist, *github.Response, error) {
+			return client.Gists.ListStarred(ctx, opt)
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Debug("Fetched starred gists", "count", len(starredGists))
+		gists = append(gists, starredGists...)
+	}
+
+	// Remove duplicates
+	var noDuplicates []*github.Gist
+	seen := make(map[string]bool)
+	for _, gist := range gists {
+		if seen[gist.GetID()] {
+			continue
+		}
+		seen[gist.GetID()] = true
+		noDuplicates = append(noDuplicates, gist)
+	}
+	return noDuplicates, nil
+}
+
+// Get the path of a gist's clone relative to the output directory: `_gists/<owner>/<id>`
+func gistPath(gist *github.Gist) string {
+	owner := gist.GetOwner().GetLogin()
+	if owner == "" {
+		owner = "anonymous"
+	}
+	return filepath.Join("_gists", owner, gist.GetID())
+}
+
+// Clone a gist to `_gists/<owner>/<id>` in the output directory and write its metadata and comments to `_gists/<owner>/<id>.json`.
+// Like with repositories, the comments are exported even if cloning fails, and the errors of both stages are joined.
+func backupGist(client *github.Client, gist *github.Gist, config BackupConfig) error {
+	outputDirectory := filepath.Join(config.Output, gistPath(gist))
+
+	var errs []error
+	err := cloneOrUpdate(gist.GetGitPullURL(), outputDirectory, config)
+	if err != nil {
+		errs = append(errs, withStage("clone", fmt.Errorf("failed to clone gist %s: %w", gist.GetID(), err)))
+	}
+	errs = append(errs, withStage("comments", exportGist(client, gist, outputDirectory+".json")))
+	// errors.Join ignores nil errors and returns nil if every error is nil
+	return errors.Join(errs...)
+}
+
+// Write a gist's metadata and comments to path
+func exportGist(client *github.Client, gist *github.Gist, path string) error {
+	export := GistExport{Gist: gist}
+	if gist.GetComments() > 0 {
+		opt := &github.ListOptions{PerPage: 100}
+		var err error
+		export.Comments, err = listAll(opt, func() ([]*github.GistComment, *github.Response, error) {
+			return client.Gists.ListComments(context.Background(), gist.GetID(), opt)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list comments for gist %s: %w", gist.GetID(), err)
+		}
+	}
+	return writeJSON(path, export)
+}
@@ -0,0 +1,107 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/go-github/v63/github"
+)
+
+// An issue along with everything attached to it, written to `<number>.json`
+type IssueExport struct {
+	Issue    *github.Issue          `json:"issue"`
+	Comments []*github.IssueComment `json:"comments"`
+	Timeline []*github.Timeline     `json:"timeline"`
+}
+
+// Export the issues (open and closed), issue comments, timeline events, labels, and milestones of a repository as JSON.
+// Pull requests are skipped as the GitHub API returns them as issues as well.
+// Files are written to the `issues` directory in the repository's metadata directory.
+func exportIssues(client *github.Client, repo *github.Repository, output string) error {
+	if !repo.GetHasIssues() {
+		log.Debug("Issues are disabled, skipping", "repository", repo.GetFullName())
+		return nil
+	}
+
+	ctx := context.Background()
+	owner := repo.GetOwner().GetLogin()
+	name := repo.GetName()
+	issuesDirectory := filepath.Join(metadataDirectory(output, repo), "issues")
+
+	labelOpt := &github.ListOptions{PerPage: 100}
+	labels, err := listAll(labelOpt, func() ([]*github.Label, *github.Response, error) {
+		return client.Issues.ListLabels(ctx, owner, name, labelOpt)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list labels for %s: %w", repo.GetFullName(), err)
+	}
+	err = writeJSON(filepath.Join(issuesDirectory, "labels.json"), labels)
+	if err != nil {
+		return err
+	}
+
+	milestoneOpt := &github.MilestoneListOptions{
+		State:       "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	milestones, err := listAll(&milestoneOpt.ListOptions, func() ([]*github.Milestone, *github.Response, error) {
+		return client.Issues.ListMilestones(ctx, owner, name, milestoneOpt)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list milestones for %s: %w", repo.GetFullName(), err)
+	}
+	err = writeJSON(filepath.Join(issuesDirectory, "milestones.json"), milestones)
+	if err != nil {
+		return err
+	}
+
+	issueOpt := &github.IssueListByRepoOptions{
+		State:       "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	issues, err := listAll(&issueOpt.ListOptions, func() ([]*github.Issue, *github.Response, error) {
+		return client.Issues.ListByRepo(ctx, owner, name, issueOpt)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list issues for %s: %w", repo.GetFullName(), err)
+	}
+
+	count := 0
+	for _, issue := range issues {
+		if issue.IsPullRequest() {
+			continue
+		}
+		export := IssueExport{Issue: issue}
+
+		// Avoid a request for issues without comments
+		if issue.GetComments() > 0 {
+			commentOpt := &github.IssueListCommentsOptions{
+				ListOptions: github.ListOptions{PerPage: 100},
+			}
+			export.Comments, err = listAll(&commentOpt.ListOptions, func() ([]*github.IssueComment, *github.Response, error) {
+				return client.Issues.ListComments(ctx, owner, name, issue.GetNumber(), commentOpt)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to list comments for %s#%d: %w", repo.GetFullName(), issue.GetNumber(), err)
+			}
+		}
+
+		timelineOpt := &github.ListOptions{PerPage: 100}
+		export.Timeline, err = listAll(timelineOpt, func() ([]*github.Timeline, *github.Response, error) {
+			return client.Issues.ListIssueTimeline(ctx, owner, name, issue.GetNumber(), timelineOpt)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list timeline for %s#%d: %w", repo.GetFullName(), issue.GetNumber(), err)
+		}
+
+		err = writeJSON(filepath.Join(issuesDirectory, fmt.Sprintf("%d.json", issue.GetNumber())), export)
+		if err != nil {
+			return err
+		}
+		count++
+	}
+	log.Debug("Exported issues", "repository", repo.GetFullName(), "count", count)
+	return nil
+}
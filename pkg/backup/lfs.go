@@ -0,0 +1,427 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/google/go-github/v63/github"
+)
+
+// Pointer files are always smaller than this, so larger blobs don't need to be read
+// https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md
+const lfsMaxPointerSize = 1024
+
+// The number of objects to request from the batch API at once
+const lfsBatchSize = 100
+
+// A Git LFS object referenced by a pointer file
+type lfsPointer struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type lfsBatchRequest struct {
+	Operation string       `json:"operation"`
+	Transfers []string     `json:"transfers"`
+	Objects   []lfsPointer `json:"objects"`
+}
+
+type lfsBatchResponse struct {
+	Objects []struct {
+		lfsPointer
+		Actions struct {
+			Download *struct {
+				Href   string            `json:"href"`
+				Header map[string]string `json:"header"`
+			} `json:"download"`
+		} `json:"actions"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+// Fetch the Git LFS objects of a cloned repository if it uses Git LFS.
+// Pointers are collected from every commit reachable from any ref, not just HEAD, and objects are stored in the repository's `lfs/objects` directory like `git lfs fetch --all` would.
+// Afterwards, every pointer is checked to have a matching object.
+func fetchLFSObjects(repo *github.Repository, config BackupConfig) error {
+	gitRepo, err := git.PlainOpen(filepath.Join(config.Output, repo.GetFullName()))
+	if err != nil {
+		return err
+	}
+	storage, ok := gitRepo.Storer.(*filesystem.Storage)
+	if !ok {
+		return fmt.Errorf("unable to find the git directory of %s", repo.GetFullName())
+	}
+	objectsDirectory := filepath.Join(storage.Filesystem().Root(), "lfs", "objects")
+
+	usesLFS, err := usesLFS(gitRepo)
+	if err != nil {
+		return err
+	}
+	if !usesLFS {
+		return nil
+	}
+
+	pointers, err := findLFSPointers(gitRepo)
+	if err != nil {
+		return err
+	}
+	log.Debug("Found LFS pointers", "repository", repo.GetFullName(), "count", len(pointers))
+
+	var missing []lfsPointer
+	for _, pointer := range pointers {
+		if verifyLFSObject(objectsDirectory, pointer) != nil {
+			missing = append(missing, pointer)
+		}
+	}
+
+	lfsURL := strings.TrimSuffix(repo.GetCloneURL(), ".git") + ".git/info/lfs"
+	for start := 0; start < len(missing); start += lfsBatchSize {
+		end := min(start+lfsBatchSize, len(missing))
+		err := config.Retry.Do(repo.GetFullName()+" LFS objects", func() error {
+			return downloadLFSBatch(lfsURL, config.Token, missing[start:end], objectsDirectory)
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to fetch LFS objects for %s: %w", repo.GetFullName(), err)
+		}
+	}
+
+	// Verify every pointer, including the objects that were already present
+	var errs []error
+	for _, pointer := range pointers {
+		err := verifyLFSObject(objectsDirectory, pointer)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d LFS objects of %s are missing or corrupt: %w", len(errs), len(pointers), repo.GetFullName(), errors.Join(errs...))
+	}
+	log.Debug("Fetched LFS objects", "repository", repo.GetFullName(), "downloaded", len(missing), "total", len(pointers))
+	return nil
+}
+
+// Check if the `.gitattributes` at the tip of any ref assigns the LFS filter to files.
+func usesLFS(gitRepo *git.Repository) (bool, error) {
+	refs, err := gitRepo.References()
+	if err != nil {
+		return false, err
+	}
+	defer refs.Close()
+
+	found := false
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		commit, err := peelToCommit(gitRepo, ref.Hash())
+		if err != nil {
+			// Refs can point to trees or blobs, which can't have a .gitattributes
+			return nil
+		}
+		file, err := commit.File(".gitattributes")
+		if err != nil {
+			return nil
+		}
+		contents, err := file.Contents()
+		if err != nil {
+			return err
+		}
+		if strings.Contains(contents, "filter=lfs") {
+			found = true
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return found, nil
+}
+
+// Get the commit a hash points to, following annotated tags.
+func peelToCommit(gitRepo *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	commit, err := gitRepo.CommitObject(hash)
+	if err == nil {
+		return commit, nil
+	}
+	tag, err := gitRepo.TagObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return tag.Commit()
+}
+
+// Walk the trees of every commit reachable from any ref and collect the LFS pointers in them.
+// Trees and blobs that were already visited are skipped, so each is only read once.
+func findLFSPointers(gitRepo *git.Repository) ([]lfsPointer, error) {
+	commits, err := gitRepo.Log(&git.LogOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	defer commits.Close()
+
+	seen := make(map[plumbing.Hash]bool)
+	pointers := make(map[string]lfsPointer)
+
+	var walkTree func(hash plumbing.Hash) error
+	walkTree = func(hash plumbing.Hash) error {
+		if seen[hash] {
+			return nil
+		}
+		seen[hash] = true
+		tree, err := gitRepo.TreeObject(hash)
+		if err != nil {
+			return err
+		}
+		for _, entry := range tree.Entries {
+			switch entry.Mode {
+			case filemode.Dir:
+				err := walkTree(entry.Hash)
+				if err != nil {
+					return err
+				}
+			case filemode.Regular, filemode.Executable:
+				if seen[entry.Hash] {
+					continue
+				}
+				seen[entry.Hash] = true
+				blob, err := gitRepo.BlobObject(entry.Hash)
+				if err != nil {
+					return err
+				}
+				if blob.Size >= lfsMaxPointerSize {
+					continue
+				}
+				pointer, ok, err := readLFSPointer(blob)
+				if err != nil {
+					return err
+				}
+				if ok {
+					pointers[pointer.Oid] = pointer
+				}
+			}
+		}
+		return nil
+	}
+
+	err = commits.ForEach(func(commit *object.Commit) error {
+		return walkTree(commit.TreeHash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var found []lfsPointer
+	for _, pointer := range pointers {
+		found = append(found, pointer)
+	}
+	return found, nil
+}
+
+// Parse a blob as an LFS pointer. ok is false if the blob isn't a pointer.
+func readLFSPointer(blob *object.Blob) (pointer lfsPointer, ok bool, err error) {
+	reader, err := blob.Reader()
+	if err != nil {
+		return lfsPointer{}, false, err
+	}
+	defer reader.Close()
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return lfsPointer{}, false, err
+	}
+	if !bytes.HasPrefix(contents, []byte("version https://git-lfs.github.com/spec/")) {
+		return lfsPointer{}, false, nil
+	}
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			// Git LFS only uses SHA-256, so other hash methods aren't valid pointers
+			var isSHA256 bool
+			pointer.Oid, isSHA256 = strings.CutPrefix(value, "sha256:")
+			if !isSHA256 {
+				return lfsPointer{}, false, nil
+			}
+		case "size":
+			pointer.Size, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return lfsPointer{}, false, nil
+			}
+		}
+	}
+	// The oid is used to build the object's path, so anything but a SHA-256 hash could escape the objects directory
+	if !isLFSOid(pointer.Oid) {
+		return lfsPointer{}, false, nil
+	}
+	return pointer, true, nil
+}
+
+// Check if oid is a SHA-256 hash in lowercase hex, as Git LFS writes it
+func isLFSOid(oid string) bool {
+	if len(oid) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range oid {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the path of an LFS object, using the same layout as Git LFS
+func lfsObjectPath(objectsDirectory string, oid string) string {
+	return filepath.Join(objectsDirectory, oid[0:2], oid[2:4], oid)
+}
+
+// Check that the object for a pointer exists in objectsDirectory and has the expected size and checksum.
+func verifyLFSObject(objectsDirectory string, pointer lfsPointer) error {
+	return verifyLFSFile(lfsObjectPath(objectsDirectory, pointer.Oid), pointer)
+}
+
+// Check that the file at path has the size and checksum of the object a pointer refers to.
+func verifyLFSFile(path string, pointer lfsPointer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	if size != pointer.Size {
+		return fmt.Errorf("size mismatch for LFS object %s: expected %d bytes, got %d", pointer.Oid, pointer.Size, size)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != pointer.Oid {
+		return fmt.Errorf("checksum mismatch for LFS object %s: got %s", pointer.Oid, actual)
+	}
+	return nil
+}
+
+// Request download actions for objects from the LFS batch API and download each object.
+// https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md
+func downloadLFSBatch(lfsURL string, token string, objects []lfsPointer, objectsDirectory string) error {
+	body, err := json.Marshal(lfsBatchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		Objects:   objects,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", lfsURL+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+	req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+	if token != "" {
+		req.SetBasicAuth(token, token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return unexpectedStatus("LFS batch API request failed", resp)
+	}
+	var batch lfsBatchResponse
+	err = json.NewDecoder(resp.Body).Decode(&batch)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range batch.Objects {
+		if !isLFSOid(object.Oid) {
+			return fmt.Errorf("invalid oid %q in the LFS batch API response", object.Oid)
+		}
+		if object.Error != nil {
+			// Objects that were never uploaded can't be fetched; the verification step reports them
+			log.Warn("LFS object unavailable", "oid", object.Oid, "code", object.Error.Code, "message", object.Error.Message)
+			continue
+		}
+		download := object.Actions.Download
+		if download == nil {
+			// No action means the server believes the object is already present
+			continue
+		}
+		err := downloadLFSObject(download.Href, download.Header, object.lfsPointer, objectsDirectory)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Download an LFS object to a temporary file, verify it, and move it into place.
+// The temporary file is kept in the same directory as Git LFS uses so the rename doesn't cross filesystems.
+func downloadLFSObject(href string, header map[string]string, pointer lfsPointer, objectsDirectory string) error {
+	req, err := http.NewRequest("GET", href, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return unexpectedStatus("failed to download LFS object "+pointer.Oid, resp)
+	}
+
+	tmpDirectory := filepath.Join(filepath.Dir(objectsDirectory), "tmp")
+	err = os.MkdirAll(tmpDirectory, 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(tmpDirectory, pointer.Oid)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = verifyLFSFile(tmp.Name(), pointer)
+	if err != nil {
+		return err
+	}
+	path := lfsObjectPath(objectsDirectory, pointer.Oid)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
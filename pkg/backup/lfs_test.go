@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const testOid = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+func testPointer(oid string, size string) string {
+	return "version https://git-lfs.github.com/spec/v1\noid " + oid + "\nsize " + size + "\n"
+}
+
+// Store contents as a blob in repo
+func testBlob(t *testing.T, repo *git.Repository, contents string) *object.Blob {
+	t.Helper()
+	encoded := repo.Storer.NewEncodedObject()
+	encoded.SetType(plumbing.BlobObject)
+	writer, err := encoded.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte(contents)); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	hash, err := repo.Storer.SetEncodedObject(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := repo.BlobObject(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
+
+func TestReadLFSPointer(t *testing.T) {
+	repo := newTestRepository(t, t.TempDir())
+	tests := []struct {
+		name     string
+		contents string
+		want     lfsPointer
+		wantOk   bool
+	}{
+		{"valid pointer", testPointer("sha256:"+testOid, "12345"), lfsPointer{Oid: testOid, Size: 12345}, true},
+		{"without a trailing newline", strings.TrimSuffix(testPointer("sha256:"+testOid, "1"), "\n"), lfsPointer{Oid: testOid, Size: 1}, true},
+		{"extension lines", "version https://git-lfs.github.com/spec/v1\next-0-foo sha256:" + testOid + "\noid sha256:" + testOid + "\nsize 3\n", lfsPointer{Oid: testOid, Size: 3}, true},
+		{"not a pointer", "package main\n", lfsPointer{}, false},
+		{"uppercase hex", testPointer("sha256:"+strings.ToUpper(testOid), "1"), lfsPointer{}, false},
+		{"short oid", testPointer("sha256:"+testOid[:63], "1"), lfsPointer{}, false},
+		{"long oid", testPointer("sha256:"+testOid+"0", "1"), lfsPointer{}, false},
+		{"empty oid", testPointer("sha256:", "1"), lfsPointer{}, false},
+		{"missing oid", "version https://git-lfs.github.com/spec/v1\nsize 1\n", lfsPointer{}, false},
+		{"path traversal", testPointer("sha256:../../../../hooks/"+testOid[:48], "1"), lfsPointer{}, false},
+		{"path traversal of the right length", testPointer("sha256:../../"+testOid[:58], "1"), lfsPointer{}, false},
+		{"separators", testPointer("sha256:"+testOid[:30]+"/"+testOid[31:], "1"), lfsPointer{}, false},
+		{"without a hash method", testPointer(testOid, "1"), lfsPointer{}, false},
+		{"other hash method", testPointer("sha1:"+testOid[:40], "1"), lfsPointer{}, false},
+		{"other hash method of the right length", testPointer("sha512:"+testOid, "1"), lfsPointer{}, false},
+		{"invalid size", testPointer("sha256:"+testOid, "large"), lfsPointer{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pointer, ok, err := readLFSPointer(testBlob(t, repo, test.contents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != test.wantOk || pointer != test.want {
+				t.Errorf("got %+v (ok: %t), want %+v (ok: %t)", pointer, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestIsLFSOid(t *testing.T) {
+	tests := []struct {
+		oid  string
+		want bool
+	}{
+		{testOid, true},
+		{strings.Repeat("0", 64), true},
+		{strings.ToUpper(testOid), false},
+		{testOid[:63], false},
+		{testOid + "a", false},
+		{"", false},
+		{"../" + testOid[3:], false},
+		{testOid[:63] + "g", false},
+	}
+	for _, test := range tests {
+		if got := isLFSOid(test.oid); got != test.want {
+			t.Errorf("isLFSOid(%q) = %t, want %t", test.oid, got, test.want)
+		}
+	}
+}
+
+func TestFindLFSPointers(t *testing.T) {
+	dir := t.TempDir()
+	repo := newTestRepository(t, dir)
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFiles := func(files map[string]string, parents ...plumbing.Hash) plumbing.Hash {
+		t.Helper()
+		for name, contents := range files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := worktree.Add(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return testCommit(t, repo, "commit", parents...)
+	}
+
+	otherOid := strings.Repeat("ab", 32)
+	branchOid := strings.Repeat("cd", 32)
+	first := commitFiles(map[string]string{
+		"README.md":           "not a pointer\n",
+		"assets/logo.png":     testPointer("sha256:"+testOid, "100"),
+		"assets/escape.png":   testPointer("sha256:../../../../config", "1"),
+		"assets/md5.png":      testPointer("md5:"+otherOid, "1"),
+		"assets/nested/a.bin": testPointer("sha256:"+otherOid, "200"),
+	})
+	// The same pointer in another file is only found once
+	commitFiles(map[string]string{"assets/copy.png": testPointer("sha256:"+testOid, "100")}, first)
+	// Pointers on any ref are found, not just HEAD
+	setTestRef(t, repo, "refs/heads/feature", first)
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/feature")); err != nil {
+		t.Fatal(err)
+	}
+	commitFiles(map[string]string{"branch.bin": testPointer("sha256:"+branchOid, "300")}, first)
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Main)); err != nil {
+		t.Fatal(err)
+	}
+
+	pointers, err := findLFSPointers(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(pointers, func(a, b lfsPointer) int { return strings.Compare(a.Oid, b.Oid) })
+	want := []lfsPointer{{Oid: testOid, Size: 100}, {Oid: otherOid, Size: 200}, {Oid: branchOid, Size: 300}}
+	slices.SortFunc(want, func(a, b lfsPointer) int { return strings.Compare(a.Oid, b.Oid) })
+	if !slices.Equal(pointers, want) {
+		t.Errorf("got %+v, want %+v", pointers, want)
+	}
+}
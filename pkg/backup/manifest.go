@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-github/v63/github"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+// The name of the manifest written to each backup directory
+const ManifestFile = "manifest.json"
+
+// Statuses of a manifest entry
+const (
+	StatusOK = "ok"
+	// The clone succeeded, but another stage (such as exporting issues) failed
+	StatusPartial = "partial"
+	StatusFailed  = "failed"
+)
+
+// Manifest describes what a backup contains. It is written to `manifest.json` in the backup directory.
+type Manifest struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	CloneMode  string    `json:"clone_mode"`
+	// StatusOK if every repository and gist was backed up, otherwise StatusPartial
+	Status string `json:"status"`
+	// Size in bytes of every repository and gist, excluding JSON exports
+	Size         int64           `json:"size"`
+	Repositories []ManifestEntry `json:"repositories"`
+	Gists        []ManifestEntry `json:"gists"`
+
+	mu sync.Mutex
+}
+
+// A repository or gist in a manifest
+type ManifestEntry struct {
+	// The repository's full name, or the gist's ID
+	Name string `json:"name"`
+	// The path of the clone, relative to the backup directory
+	Path string `json:"path"`
+	// Where the repository came from: `owned`, `starred`, `org`, or `gist`
+	Sources       []string          `json:"sources"`
+	DefaultBranch string            `json:"default_branch,omitempty"`
+	PushedAt      *github.Timestamp `json:"pushed_at,omitempty"`
+	// The commit each ref points to, including `HEAD`
+	Refs map[string]string `json:"refs"`
+	// Size of the clone in bytes
+	Size int64 `json:"size"`
+	// How long backing up took, in nanoseconds
+	Duration time.Duration   `json:"duration"`
+	Status   string          `json:"status"`
+	Failures []BackupFailure `json:"failures,omitempty"`
+}
+
+// ReadManifest reads the manifest of the backup directory dir
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ManifestFile, err)
+	}
+	return manifest, nil
+}
+
+// Add an entry for a repository or gist that was backed up.
+// Safe to call from multiple goroutines.
+func (m *Manifest) add(entry ManifestEntry, gist bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if gist {
+		m.Gists = append(m.Gists, entry)
+	} else {
+		m.Repositories = append(m.Repositories, entry)
+	}
+	m.Size += entry.Size
+}
+
+// Sort the entries, set the overall status, and mark the manifest as finished
+func (m *Manifest) finish() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	compare := func(a, b ManifestEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	}
+	slices.SortFunc(m.Repositories, compare)
+	slices.SortFunc(m.Gists, compare)
+
+	m.Status = StatusOK
+	for _, entry := range append(slices.Clone(m.Repositories), m.Gists...) {
+		if entry.Status != StatusOK {
+			m.Status = StatusPartial
+			break
+		}
+	}
+	m.FinishedAt = time.Now()
+}
+
+// Describe a repository or gist that was cloned to output/path.
+// err is the error returned when backing it up, which decides the status.
+func newManifestEntry(name string, output string, path string, sources []string, duration time.Duration, err error) ManifestEntry {
+	entry := ManifestEntry{
+		Name:     name,
+		Path:     path,
+		Sources:  sources,
+		Duration: duration,
+	}
+	entry.setStatus(err)
+
+	clonePath := filepath.Join(output, path)
+	entry.Refs, _ = readRefs(clonePath)
+	entry.Size, _ = utils.DirSize(clonePath)
+	return entry
+}
+
+// Set the status and failures of an entry from the error returned when backing it up.
+// Called again if a later stage, such as archiving, fails.
+func (e *ManifestEntry) setStatus(err error) {
+	e.Status = StatusOK
+	e.Failures = nil
+	if err == nil {
+		return
+	}
+	e.Failures = failuresFromError(e.Name, err)
+	e.Status = StatusPartial
+	for _, failure := range e.Failures {
+		if failure.Stage == "clone" {
+			e.Status = StatusFailed
+		}
+	}
+}
+
+// Get the commit (or other object) each ref in a repository points to.
+// Symbolic refs, such as HEAD, are resolved.
+func readRefs(path string) (map[string]string, error) {
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := gitRepo.References()
+	if err != nil {
+		return nil, err
+	}
+	defer refs.Close()
+
+	found := make(map[string]string)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.SymbolicReference {
+			resolved, err := gitRepo.Reference(ref.Name(), true)
+			if err != nil {
+				// Such as HEAD pointing to a branch that doesn't exist in an empty repository
+				return nil
+			}
+			ref = plumbing.NewHashReference(ref.Name(), resolved.Hash())
+		}
+		found[ref.Name().String()] = ref.Hash().String()
+		return nil
+	})
+	return found, err
+}
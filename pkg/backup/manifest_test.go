@@ -0,0 +1,30 @@
+package backup
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"success", nil, StatusOK},
+		{"failed clone", withStage("clone", errors.New("connection reset")), StatusFailed},
+		{"failed export", withStage("issues", errors.New("rate limited")), StatusPartial},
+		// A gist whose clone succeeded but whose comments couldn't be exported was still backed up
+		{"failed gist comments", errors.Join(nil, withStage("comments", errors.New("rate limited"))), StatusPartial},
+		{"failed clone and export", errors.Join(withStage("clone", errors.New("not found")), withStage("comments", errors.New("not found"))), StatusFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := ManifestEntry{Name: "acme/api"}
+			entry.setStatus(test.err)
+			if entry.Status != test.want {
+				t.Errorf("got status %s, want %s", entry.Status, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package backup
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/charmbracelet/log"
+	"github.com/schollz/progressbar/v3"
+)
+
+// A unit of work in a backup, such as cloning a repository and exporting its metadata
+type backupJob struct {
+	// Shown in logs, such as the repository's full name
+	name string
+	// The host the job connects to, used for per-host limits
+	host string
+	run  func() error
+}
+
+// Get the host of a URL for per-host limits. If the URL can't be parsed, it is used as is.
+func hostOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return rawURL
+	}
+	return parsed.Host
+}
+
+// Jobs waiting to run, queued per host so a worker only takes a job once its host has a free slot
+type jobQueue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// The indices of the jobs waiting for each host, in order
+	pending map[string][]int
+	// The number of jobs running for each host
+	running map[string]int
+	jobs    []backupJob
+	perHost int
+	queued  int
+}
+
+func newJobQueue(jobs []backupJob, perHost int) *jobQueue {
+	q := &jobQueue{
+		pending: make(map[string][]int),
+		running: make(map[string]int),
+		jobs:    jobs,
+		perHost: perHost,
+		queued:  len(jobs),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	for i, job := range jobs {
+		q.pending[job.host] = append(q.pending[job.host], i)
+	}
+	return q
+}
+
+// Take the earliest queued job whose host has a free slot, waiting until one does.
+// It returns false once every job has been taken.
+func (q *jobQueue) take() (backupJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.queued > 0 {
+		next := -1
+		for host, indices := range q.pending {
+			if len(indices) == 0 || (q.perHost > 0 && q.running[host] >= q.perHost) {
+				continue
+			}
+			if next == -1 || indices[0] < next {
+				next = indices[0]
+			}
+		}
+		if next == -1 {
+			// Every host with queued jobs is at its limit
+			q.cond.Wait()
+			continue
+		}
+		job := q.jobs[next]
+		q.pending[job.host] = q.pending[job.host][1:]
+		q.running[job.host]++
+		q.queued--
+		return job, true
+	}
+	return backupJob{}, false
+}
+
+// Free the host slot of a job that finished
+func (q *jobQueue) done(job backupJob) {
+	q.mu.Lock()
+	q.running[job.host]--
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// Run jobs on a pool of concurrency workers, with at most perHost jobs for the same host running at once.
+// If perHost is 0, only concurrency limits how many jobs run at once.
+// A worker only takes a job whose host has a free slot, so jobs for other hosts aren't stuck behind a host at its limit.
+// The progress bar's description shows how many jobs are running and how many are queued.
+// Every job is run even if others fail, and the failures of all jobs are returned in the order they occurred.
+func runJobs(jobs []backupJob, concurrency int, perHost int, bar *progressbar.ProgressBar) []BackupFailure {
+	queue := newJobQueue(jobs, perHost)
+
+	var running, queued atomic.Int64
+	queued.Store(int64(len(jobs)))
+	describe := func() {
+		bar.Describe(fmt.Sprintf("%d running, %d queued", running.Load(), queued.Load()))
+	}
+	describe()
+
+	var mu sync.Mutex
+	var failures []BackupFailure
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, ok := queue.take()
+				if !ok {
+					return
+				}
+				queued.Add(-1)
+				running.Add(1)
+				describe()
+
+				err := job.run()
+
+				queue.done(job)
+				running.Add(-1)
+				if err != nil {
+					log.Error("Failed to back up", "name", job.name, "err", err)
+					mu.Lock()
+					failures = append(failures, failuresFromError(job.name, err)...)
+					mu.Unlock()
+				}
+				// Failed jobs count as done so the progress bar completes
+				bar.Add(1)
+				describe()
+			}
+		}()
+	}
+	wg.Wait()
+	return failures
+}
@@ -0,0 +1,167 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+func TestRunJobsPerHostLimit(t *testing.T) {
+	const concurrency, perHost = 6, 2
+	var mu sync.Mutex
+	running := make(map[string]int)
+	maxRunning := make(map[string]int)
+	var total, maxTotal int
+	var ran atomic.Int64
+
+	var jobs []backupJob
+	for i := range 30 {
+		host := []string{"github.com", "gist.github.com", "example.com"}[i%3]
+		jobs = append(jobs, backupJob{
+			name: fmt.Sprintf("job %d", i),
+			host: host,
+			run: func() error {
+				mu.Lock()
+				running[host]++
+				total++
+				maxRunning[host] = max(maxRunning[host], running[host])
+				maxTotal = max(maxTotal, total)
+				mu.Unlock()
+
+				time.Sleep(5 * time.Millisecond)
+				ran.Add(1)
+
+				mu.Lock()
+				running[host]--
+				total--
+				mu.Unlock()
+				return nil
+			},
+		})
+	}
+
+	failures := runJobs(jobs, concurrency, perHost, progressbar.DefaultSilent(int64(len(jobs))))
+	if len(failures) != 0 {
+		t.Errorf("got failures %+v", failures)
+	}
+	if got := ran.Load(); got != int64(len(jobs)) {
+		t.Errorf("ran %d jobs, want %d", got, len(jobs))
+	}
+	for host, got := range maxRunning {
+		if got > perHost {
+			t.Errorf("%d jobs ran at once for %s, want at most %d", got, host, perHost)
+		}
+	}
+	if maxTotal > concurrency {
+		t.Errorf("%d jobs ran at once, want at most %d", maxTotal, concurrency)
+	}
+}
+
+func TestRunJobsConcurrency(t *testing.T) {
+	// Without a per-host limit, jobs for the same host still only run concurrency at a time
+	const concurrency = 3
+	var running, maxRunning atomic.Int64
+	var jobs []backupJob
+	for i := range 12 {
+		jobs = append(jobs, backupJob{
+			name: fmt.Sprintf("job %d", i),
+			host: "github.com",
+			run: func() error {
+				now := running.Add(1)
+				for {
+					previous := maxRunning.Load()
+					if now <= previous || maxRunning.CompareAndSwap(previous, now) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+				return nil
+			},
+		})
+	}
+	runJobs(jobs, concurrency, 0, progressbar.DefaultSilent(int64(len(jobs))))
+	if got := maxRunning.Load(); got > concurrency {
+		t.Errorf("%d jobs ran at once, want at most %d", got, concurrency)
+	}
+}
+
+func TestRunJobsContinuesPastFailures(t *testing.T) {
+	var ran atomic.Int64
+	var jobs []backupJob
+	for i := range 10 {
+		jobs = append(jobs, backupJob{
+			name: fmt.Sprintf("acme/repo-%d", i),
+			host: "github.com",
+			run: func() error {
+				ran.Add(1)
+				switch i {
+				case 0:
+					return withStage("clone", errors.New("not found"))
+				case 5:
+					return errors.Join(withStage("issues", errors.New("rate limited")), withStage("releases", errors.New("bad gateway")))
+				}
+				return nil
+			},
+		})
+	}
+
+	failures := runJobs(jobs, 2, 1, progressbar.DefaultSilent(int64(len(jobs))))
+	if got := ran.Load(); got != int64(len(jobs)) {
+		t.Errorf("ran %d jobs, want %d", got, len(jobs))
+	}
+	want := map[string]bool{"acme/repo-0 clone": true, "acme/repo-5 issues": true, "acme/repo-5 releases": true}
+	if len(failures) != len(want) {
+		t.Fatalf("got failures %+v, want one for each of %v", failures, want)
+	}
+	for _, failure := range failures {
+		if !want[failure.Name+" "+failure.Stage] {
+			t.Errorf("unexpected failure %+v", failure)
+		}
+	}
+}
+
+func TestRunJobsHostsProgressTogether(t *testing.T) {
+	// Repositories are queued before gists, but a gist doesn't wait for every repository when github.com is at its limit
+	var gistStarted sync.Once
+	started := make(chan struct{})
+	var waited atomic.Int64
+	var jobs []backupJob
+	for i := range 6 {
+		jobs = append(jobs, backupJob{
+			name: fmt.Sprintf("acme/repo-%d", i),
+			host: "github.com",
+			run: func() error {
+				select {
+				case <-started:
+				case <-time.After(time.Second):
+					waited.Add(1)
+				}
+				return nil
+			},
+		})
+	}
+	for i := range 2 {
+		jobs = append(jobs, backupJob{
+			name: fmt.Sprintf("gist %d", i),
+			host: "gist.github.com",
+			run: func() error {
+				gistStarted.Do(func() { close(started) })
+				return nil
+			},
+		})
+	}
+
+	failures := runJobs(jobs, 3, 1, progressbar.DefaultSilent(int64(len(jobs))))
+	if len(failures) != 0 {
+		t.Errorf("got failures %+v", failures)
+	}
+	if got := waited.Load(); got > 0 {
+		t.Errorf("%d repositories finished before any gist started, want gists to run alongside them", got)
+	}
+}
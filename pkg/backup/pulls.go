@@ -0,0 +1,109 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/go-github/v63/github"
+)
+
+// A pull request along with its discussion, written to `<number>.json`
+type PullRequestExport struct {
+	PullRequest *github.PullRequest `json:"pull_request"`
+	// Conversation comments, which the GitHub API treats as issue comments
+	Comments []*github.IssueComment      `json:"comments"`
+	Reviews  []*github.PullRequestReview `json:"reviews"`
+	// Comments left on lines of the diff, including replies in review threads
+	ReviewComments []*github.PullRequestComment `json:"review_comments"`
+	Commits        []*github.RepositoryCommit   `json:"commits"`
+}
+
+// Export the pull requests (open and closed) of a repository as JSON, along with the `.patch` and `.diff` of each pull request.
+// Files are written to the `pulls` directory in the repository's metadata directory.
+func exportPullRequests(client *github.Client, repo *github.Repository, output string) error {
+	ctx := context.Background()
+	owner := repo.GetOwner().GetLogin()
+	name := repo.GetName()
+	pullsDirectory := filepath.Join(metadataDirectory(output, repo), "pulls")
+
+	pullOpt := &github.PullRequestListOptions{
+		State:       "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	pulls, err := listAll(&pullOpt.ListOptions, func() ([]*github.PullRequest, *github.Response, error) {
+		return client.PullRequests.List(ctx, owner, name, pullOpt)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pull requests for %s: %w", repo.GetFullName(), err)
+	}
+
+	for _, pull := range pulls {
+		number := pull.GetNumber()
+		export := PullRequestExport{PullRequest: pull}
+
+		commentOpt := &github.IssueListCommentsOptions{
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+		export.Comments, err = listAll(&commentOpt.ListOptions, func() ([]*github.IssueComment, *github.Response, error) {
+			return client.Issues.ListComments(ctx, owner, name, number, commentOpt)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list comments for %s#%d: %w", repo.GetFullName(), number, err)
+		}
+
+		reviewOpt := &github.ListOptions{PerPage: 100}
+		export.Reviews, err = listAll(reviewOpt, func() ([]*github.PullRequestReview, *github.Response, error) {
+			return client.PullRequests.ListReviews(ctx, owner, name, number, reviewOpt)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list reviews for %s#%d: %w", repo.GetFullName(), number, err)
+		}
+
+		reviewCommentOpt := &github.PullRequestListCommentsOptions{
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+		export.ReviewComments, err = listAll(&reviewCommentOpt.ListOptions, func() ([]*github.PullRequestComment, *github.Response, error) {
+			return client.PullRequests.ListComments(ctx, owner, name, number, reviewCommentOpt)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list review comments for %s#%d: %w", repo.GetFullName(), number, err)
+		}
+
+		commitOpt := &github.ListOptions{PerPage: 100}
+		export.Commits, err = listAll(commitOpt, func() ([]*github.RepositoryCommit, *github.Response, error) {
+			return client.PullRequests.ListCommits(ctx, owner, name, number, commitOpt)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list commits for %s#%d: %w", repo.GetFullName(), number, err)
+		}
+
+		err = writeJSON(filepath.Join(pullsDirectory, fmt.Sprintf("%d.json", number)), export)
+		if err != nil {
+			return err
+		}
+
+		for extension, rawType := range map[string]github.RawType{"patch": github.Patch, "diff": github.Diff} {
+			raw, _, err := client.PullRequests.GetRaw(ctx, owner, name, number, github.RawOptions{Type: rawType})
+			if err != nil {
+				// GitHub refuses to render diffs that are too large; the commits are still in the clone
+				var errorResponse *github.ErrorResponse
+				if errors.As(err, &errorResponse) && errorResponse.Response.StatusCode == http.StatusNotAcceptable {
+					log.Warn("Pull request is too large to export as a "+extension+", skipping", "repository", repo.GetFullName(), "number", number)
+					continue
+				}
+				return fmt.Errorf("failed to get %s for %s#%d: %w", extension, repo.GetFullName(), number, err)
+			}
+			err = os.WriteFile(filepath.Join(pullsDirectory, fmt.Sprintf("%d.%s", number, extension)), []byte(raw), 0644)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	log.Debug("Exported pull requests", "repository", repo.GetFullName(), "count", len(pulls))
+	return nil
+}
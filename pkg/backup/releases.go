@@ -0,0 +1,212 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/go-github/v63/github"
+)
+
+// go-github doesn't expose the digest GitHub returns for release assets, so it is decoded separately
+type releaseAssetDigests struct {
+	Assets []struct {
+		ID int64 `json:"id"`
+		// In the format `sha256:<hex>`. Assets uploaded before GitHub started computing digests don't have one.
+		Digest string `json:"digest"`
+	} `json:"assets"`
+}
+
+// Export the releases of a repository as JSON and download every release asset.
+// Releases are written to `releases/releases.json` in the repository's metadata directory, and assets to `releases/<tag>/<asset>`.
+// Assets are downloaded to a `.part` file first so interrupted downloads can be resumed, and are verified against their size and digest.
+// If ReleaseAssetsMaxSize is above 0, assets that would bring the total size of the repository's assets over it are skipped.
+func exportReleases(client *github.Client, repo *github.Repository, config BackupConfig) error {
+	ctx := context.Background()
+	owner := repo.GetOwner().GetLogin()
+	name := repo.GetName()
+	releasesDirectory := filepath.Join(metadataDirectory(config.Output, repo), "releases")
+
+	// The raw JSON is kept so the digests of assets are exported as well
+	opt := &github.ListOptions{PerPage: 100}
+	rawReleases, err := listAll(opt, func() ([]json.RawMessage, *github.Response, error) {
+		req, err := client.NewRequest("GET", fmt.Sprintf("repos/%v/%v/releases?per_page=%d&page=%d", owner, name, opt.PerPage, opt.Page), nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		var releases []json.RawMessage
+		resp, err := client.Do(ctx, req, &releases)
+		return releases, resp, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list releases for %s: %w", repo.GetFullName(), err)
+	}
+	if len(rawReleases) == 0 {
+		return nil
+	}
+	err = writeJSON(filepath.Join(releasesDirectory, "releases.json"), rawReleases)
+	if err != nil {
+		return err
+	}
+
+	var totalSize uint64
+	for _, rawRelease := range rawReleases {
+		var release github.RepositoryRelease
+		err := json.Unmarshal(rawRelease, &release)
+		if err != nil {
+			return err
+		}
+		var digests releaseAssetDigests
+		err = json.Unmarshal(rawRelease, &digests)
+		if err != nil {
+			return err
+		}
+		digestByID := make(map[int64]string)
+		for _, asset := range digests.Assets {
+			digestByID[asset.ID] = asset.Digest
+		}
+
+		// Drafts may not have a tag yet
+		releaseDirectory := release.GetTagName()
+		if releaseDirectory == "" {
+			releaseDirectory = strconv.FormatInt(release.GetID(), 10)
+		}
+		for _, asset := range release.Assets {
+			size := uint64(asset.GetSize())
+			if config.ReleaseAssetsMaxSize > 0 && totalSize+size > config.ReleaseAssetsMaxSize {
+				log.Warn("Skipping release asset as it would exceed the maximum size of release assets for the repository", "repository", repo.GetFullName(), "release", release.GetTagName(), "asset", asset.GetName(), "size", size, "max", config.ReleaseAssetsMaxSize)
+				continue
+			}
+			path := filepath.Join(releasesDirectory, releaseDirectory, asset.GetName())
+			// Retries resume from what the failed attempt downloaded
+			err := config.Retry.Do(path, func() error {
+				return downloadReleaseAsset(asset, digestByID[asset.GetID()], path, config.Token)
+			}, nil)
+			if err != nil {
+				return fmt.Errorf("failed to download release asset %s from %s: %w", asset.GetName(), repo.GetFullName(), err)
+			}
+			totalSize += size
+		}
+	}
+	log.Debug("Exported releases", "repository", repo.GetFullName(), "count", len(rawReleases), "assetBytes", totalSize)
+	return nil
+}
+
+// Download a release asset to path, resuming from `<path>.part` if a previous download was interrupted.
+// If path already exists and matches the asset, nothing is downloaded.
+func downloadReleaseAsset(asset *github.ReleaseAsset, digest string, path string, token string) error {
+	if err := verifyReleaseAsset(path, asset, digest); err == nil {
+		log.Debug("Release asset already downloaded", "path", path)
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	partPath := path + ".part"
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+	if offset == int64(asset.GetSize()) {
+		// The download finished but wasn't moved into place, such as if the process was killed.
+		// Requesting the rest would fail with 416 Range Not Satisfiable.
+		if err := verifyReleaseAsset(partPath, asset, digest); err == nil {
+			return os.Rename(partPath, path)
+		}
+		offset = 0
+	}
+	// Start over if the partial download is somehow larger than the asset
+	if offset > int64(asset.GetSize()) {
+		offset = 0
+	}
+
+	// The API URL works for private repositories as well. It redirects to the actual file, and the Authorization header isn't sent to the other host.
+	req, err := http.NewRequest("GET", asset.GetURL(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		log.Debug("Resuming release asset download", "path", path, "offset", offset)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// The server ignored the range, so the whole file is being sent
+		flags |= os.O_TRUNC
+	default:
+		return unexpectedStatus("failed to download "+asset.GetURL(), resp)
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Keep the partial download so it can be resumed
+		return err
+	}
+
+	err = verifyReleaseAsset(partPath, asset, digest)
+	if err != nil {
+		// Resuming wouldn't fix a corrupt file
+		os.Remove(partPath)
+		return err
+	}
+	return os.Rename(partPath, path)
+}
+
+// Check that the file at path has the size of the asset and, if the digest is known, the same SHA-256 checksum.
+func verifyReleaseAsset(path string, asset *github.ReleaseAsset, digest string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	if size != int64(asset.GetSize()) {
+		return fmt.Errorf("size mismatch for %s: expected %d bytes, got %d", path, asset.GetSize(), size)
+	}
+
+	expected, found := strings.CutPrefix(digest, "sha256:")
+	if !found {
+		return nil
+	}
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch for %s: expected sha256:%s, got sha256:%s", path, expected, actual)
+	}
+	return nil
+}
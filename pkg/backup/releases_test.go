@@ -0,0 +1,279 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v63/github"
+)
+
+// A server for release assets that records the Range header of each request
+type testAssetServer struct {
+	*httptest.Server
+	// Assets by path, such as `/assets/1`
+	assets map[string][]byte
+	// ignoreRange sends the whole asset with 200 even if a range is requested
+	ignoreRange bool
+	// truncate sends this many bytes fewer than the asset has
+	truncate int
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func newTestAssetServer(t *testing.T, assets map[string][]byte) *testAssetServer {
+	t.Helper()
+	server := &testAssetServer{assets: assets}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asset, ok := server.assets[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Accept") != "application/octet-stream" {
+			t.Errorf("got Accept %q, want application/octet-stream", r.Header.Get("Accept"))
+		}
+		requested := r.Header.Get("Range")
+		server.mu.Lock()
+		server.ranges = append(server.ranges, requested)
+		server.mu.Unlock()
+
+		asset = asset[:len(asset)-server.truncate]
+		if start, ok := strings.CutPrefix(requested, "bytes="); ok && !server.ignoreRange {
+			offset, err := strconv.Atoi(strings.TrimSuffix(start, "-"))
+			if err != nil || offset >= len(asset) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(asset)-1, len(asset)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(asset[offset:])
+			return
+		}
+		w.Write(asset)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Get the Range headers of the requests so far, with "" for requests without one
+func (s *testAssetServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ranges...)
+}
+
+func testDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestDownloadReleaseAsset(t *testing.T) {
+	data := []byte(strings.Repeat("release asset contents ", 100))
+	corrupt := append([]byte("X"), data[1:]...)
+	tests := []struct {
+		name string
+		// Contents of the destination and `.part` file before downloading, if any
+		existing, part []byte
+		digest         string
+		ignoreRange    bool
+		truncate       int
+		wantRequests   []string
+		wantErr        bool
+	}{
+		{
+			name:         "fresh download",
+			digest:       testDigest(data),
+			wantRequests: []string{""},
+		},
+		{
+			name:         "without a digest",
+			wantRequests: []string{""},
+		},
+		{
+			name:         "resumes a partial download",
+			part:         data[:1000],
+			digest:       testDigest(data),
+			wantRequests: []string{"bytes=1000-"},
+		},
+		{
+			name:         "server ignores the range",
+			part:         data[:1000],
+			digest:       testDigest(data),
+			ignoreRange:  true,
+			wantRequests: []string{"bytes=1000-"},
+		},
+		{
+			name:         "complete partial download is moved into place",
+			part:         data,
+			digest:       testDigest(data),
+			wantRequests: nil,
+		},
+		{
+			name:         "complete but corrupt partial download is downloaded again",
+			part:         corrupt,
+			digest:       testDigest(data),
+			wantRequests: []string{""},
+		},
+		{
+			name:         "partial download larger than the asset is downloaded again",
+			part:         append(data, data...),
+			digest:       testDigest(data),
+			wantRequests: []string{""},
+		},
+		{
+			name:         "already downloaded",
+			existing:     data,
+			digest:       testDigest(data),
+			wantRequests: nil,
+		},
+		{
+			name:         "corrupt existing file is replaced",
+			existing:     corrupt,
+			digest:       testDigest(data),
+			wantRequests: []string{""},
+		},
+		{
+			name:         "checksum mismatch",
+			digest:       testDigest(corrupt),
+			wantRequests: []string{""},
+			wantErr:      true,
+		},
+		{
+			name:         "size mismatch",
+			digest:       testDigest(data),
+			truncate:     10,
+			wantRequests: []string{""},
+			wantErr:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestAssetServer(t, map[string][]byte{"/assets/1": data})
+			server.ignoreRange = test.ignoreRange
+			server.truncate = test.truncate
+			asset := &github.ReleaseAsset{
+				ID:   github.Int64(1),
+				Name: github.String("asset.bin"),
+				Size: github.Int(len(data)),
+				URL:  github.String(server.URL + "/assets/1"),
+			}
+			path := filepath.Join(t.TempDir(), "v1", "asset.bin")
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if test.existing != nil {
+				if err := os.WriteFile(path, test.existing, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.part != nil {
+				if err := os.WriteFile(path+".part", test.part, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := downloadReleaseAsset(asset, test.digest, path, "")
+			if got := server.requests(); !slices.Equal(got, test.wantRequests) {
+				t.Errorf("got requests with ranges %q, want %q", got, test.wantRequests)
+			}
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				// A mismatching download can't be fixed by resuming it
+				if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+					t.Errorf("expected the partial download to be removed, got %v", err)
+				}
+				if test.existing == nil {
+					if _, err := os.Stat(path); !os.IsNotExist(err) {
+						t.Errorf("expected nothing at %s, got %v", path, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(path); string(got) != string(data) {
+				t.Errorf("got %d bytes that don't match the asset", len(got))
+			}
+			if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+				t.Errorf("expected the partial download to be moved into place, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExportReleasesMaxSize(t *testing.T) {
+	assets := map[string][]byte{
+		"/assets/1": []byte(strings.Repeat("a", 400)),
+		"/assets/2": []byte(strings.Repeat("b", 500)),
+		"/assets/3": []byte(strings.Repeat("c", 100)),
+	}
+	server := newTestAssetServer(t, assets)
+	asset := func(id int, name string) map[string]any {
+		data := assets[fmt.Sprintf("/assets/%d", id)]
+		return map[string]any{
+			"id":     id,
+			"name":   name,
+			"size":   len(data),
+			"url":    fmt.Sprintf("%s/assets/%d", server.URL, id),
+			"digest": testDigest(data),
+		}
+	}
+	releases := []map[string]any{
+		{"id": 10, "tag_name": "v2", "assets": []any{asset(1, "first.bin"), asset(2, "second.bin")}},
+		{"id": 11, "tag_name": "", "draft": true, "assets": []any{asset(3, "third.bin")}},
+	}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/api/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(releases)
+	}))
+	defer api.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(api.URL + "/")
+
+	output := t.TempDir()
+	repo := &github.Repository{Name: github.String("api"), FullName: github.String("acme/api"), Owner: &github.User{Login: github.String("acme")}}
+	// The second asset would bring the total over the limit, but the third one still fits
+	err := exportReleases(client, repo, BackupConfig{Output: output, ReleaseAssetsMaxSize: 600})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	releasesDirectory := filepath.Join(output, "_metadata", "acme", "api", "releases")
+	for _, want := range []struct {
+		path   string
+		exists bool
+	}{
+		{"releases.json", true},
+		{"v2/first.bin", true},
+		{"v2/second.bin", false},
+		// Drafts without a tag are named after their ID
+		{"11/third.bin", true},
+	} {
+		_, err := os.Stat(filepath.Join(releasesDirectory, want.path))
+		if exists := err == nil; exists != want.exists {
+			t.Errorf("%s exists: %t, want %t", want.path, exists, want.exists)
+		}
+	}
+	if got := server.requests(); len(got) != 2 {
+		t.Errorf("got %d asset downloads, want 2", len(got))
+	}
+}
@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/slashtechno/gobackup-github/pkg/storage"
+)
+
+// Returned (wrapped) by Backup when everything was attempted but some repositories or gists failed to back up
+var ErrIncompleteBackup = errors.New("backup incomplete")
+
+// A failure to back up part of a repository or gist
+type BackupFailure struct {
+	// The repository's full name, or `gist <id>` for gists
+	Name string `json:"name"`
+	// The part of the backup that failed, such as `clone` or `issues`
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+}
+
+// Written to `failures.json` in the output directory after cloning
+type BackupReport struct {
+	// The number of repositories and gists that were backed up, including ones that failed
+	Total    int             `json:"total"`
+	Failures []BackupFailure `json:"failures"`
+}
+
+// An error that happened during a specific stage of backing up a repository or gist
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return e.stage + ": " + e.err.Error()
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+// Wrap err with the stage it happened in. If err is nil, nil is returned.
+func withStage(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &stageError{stage: stage, err: err}
+}
+
+// Turn the error returned by a job into one failure per stage that failed.
+// Errors joined with errors.Join are split up, even if they were wrapped again, and errors without a stage are reported under the `backup` stage.
+// If a stage failed more than once, its errors are combined into a single failure.
+func failuresFromError(name string, err error) []BackupFailure {
+	var failures []BackupFailure
+	byStage := make(map[string]int)
+	for _, failure := range splitFailures(name, err) {
+		if i, ok := byStage[failure.Stage]; ok {
+			failures[i].Error += "; " + failure.Error
+			continue
+		}
+		byStage[failure.Stage] = len(failures)
+		failures = append(failures, failure)
+	}
+	return failures
+}
+
+func splitFailures(name string, err error) []BackupFailure {
+	switch wrapped := err.(type) {
+	case interface{ Unwrap() []error }:
+		var failures []BackupFailure
+		for _, err := range wrapped.Unwrap() {
+			failures = append(failures, splitFailures(name, err)...)
+		}
+		return failures
+	case *stageError:
+		return []BackupFailure{{Name: name, Stage: wrapped.stage, Error: wrapped.err.Error()}}
+	case interface{ Unwrap() error }:
+		// Wrapping can hide the stages of joined errors, such as fmt.Errorf("...: %w", errors.Join(...))
+		if inner := wrapped.Unwrap(); inner != nil {
+			failures := splitFailures(name, inner)
+			if len(failures) > 1 || (len(failures) == 1 && failures[0].Stage != "backup") {
+				return failures
+			}
+		}
+	}
+	return []BackupFailure{{Name: name, Stage: "backup", Error: err.Error()}}
+}
+
+// Add a failure for removing old backups from the storage, if that failed, to the failures of the repositories and gists
+func withPruneFailure(failures []BackupFailure, store storage.Storage, pruneErr error) []BackupFailure {
+	if pruneErr == nil {
+		return failures
+	}
+	return append(slices.Clip(failures), BackupFailure{Name: fmt.Sprint(store), Stage: "prune", Error: pruneErr.Error()})
+}
+
+// Get the error a backup returns once everything else has been saved: ErrIncompleteBackup if the upload, removing old backups from the storage, or any repository or gist failed, or nil.
+// A failed upload or prune leaves the local backup in place, so the next backup is still attempted.
+func backupResult(failures []BackupFailure, store storage.Storage, uploadErr error, pruneErr error) error {
+	if uploadErr != nil {
+		return fmt.Errorf("%w: upload to %s failed: %w", ErrIncompleteBackup, store, uploadErr)
+	}
+	if pruneErr != nil {
+		return fmt.Errorf("%w: pruning the storage failed: %w", ErrIncompleteBackup, pruneErr)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%w: %d failures", ErrIncompleteBackup, len(failures))
+	}
+	return nil
+}
+
+// Print the failures as a table
+func printFailures(w io.Writer, failures []BackupFailure) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tSTAGE\tERROR")
+	for _, failure := range failures {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", failure.Name, failure.Stage, failure.Error)
+	}
+	return table.Flush()
+}
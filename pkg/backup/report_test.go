@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestFailuresFromError(t *testing.T) {
+	notFound := errors.New("not found")
+	rateLimited := errors.New("rate limited")
+	tests := []struct {
+		name string
+		err  error
+		want []BackupFailure
+	}{
+		{
+			name: "without a stage",
+			err:  notFound,
+			want: []BackupFailure{{Name: "acme/api", Stage: "backup", Error: "not found"}},
+		},
+		{
+			name: "with a stage",
+			err:  withStage("clone", notFound),
+			want: []BackupFailure{{Name: "acme/api", Stage: "clone", Error: "not found"}},
+		},
+		{
+			name: "wrapped stage",
+			err:  fmt.Errorf("archiving: %w", withStage("archive", notFound)),
+			want: []BackupFailure{{Name: "acme/api", Stage: "archive", Error: "not found"}},
+		},
+		{
+			name: "joined stages",
+			err:  errors.Join(withStage("clone", notFound), nil, withStage("issues", rateLimited)),
+			want: []BackupFailure{
+				{Name: "acme/api", Stage: "clone", Error: "not found"},
+				{Name: "acme/api", Stage: "issues", Error: "rate limited"},
+			},
+		},
+		{
+			name: "nested joins",
+			err:  errors.Join(errors.Join(withStage("clone", notFound), withStage("wiki", notFound)), withStage("releases", rateLimited)),
+			want: []BackupFailure{
+				{Name: "acme/api", Stage: "clone", Error: "not found"},
+				{Name: "acme/api", Stage: "wiki", Error: "not found"},
+				{Name: "acme/api", Stage: "releases", Error: "rate limited"},
+			},
+		},
+		{
+			name: "wrapped join",
+			err:  fmt.Errorf("backing up: %w", errors.Join(withStage("clone", notFound), withStage("comments", rateLimited))),
+			want: []BackupFailure{
+				{Name: "acme/api", Stage: "clone", Error: "not found"},
+				{Name: "acme/api", Stage: "comments", Error: "rate limited"},
+			},
+		},
+		{
+			name: "join of a staged and an unstaged error",
+			err:  errors.Join(withStage("clone", notFound), rateLimited),
+			want: []BackupFailure{
+				{Name: "acme/api", Stage: "clone", Error: "not found"},
+				{Name: "acme/api", Stage: "backup", Error: "rate limited"},
+			},
+		},
+		{
+			name: "stage that failed twice",
+			err:  errors.Join(withStage("lfs", notFound), withStage("issues", rateLimited), withStage("lfs", rateLimited)),
+			want: []BackupFailure{
+				{Name: "acme/api", Stage: "lfs", Error: "not found; rate limited"},
+				{Name: "acme/api", Stage: "issues", Error: "rate limited"},
+			},
+		},
+		{
+			name: "stage with joined errors",
+			err:  withStage("lfs", errors.Join(notFound, rateLimited)),
+			want: []BackupFailure{{Name: "acme/api", Stage: "lfs", Error: "not found\nrate limited"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := failuresFromError("acme/api", test.err); !slices.Equal(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBackupResult(t *testing.T) {
+	failures := []BackupFailure{{Name: "acme/api", Stage: "clone", Error: "not found"}}
+	tests := []struct {
+		name       string
+		failures   []BackupFailure
+		uploadErr  error
+		pruneErr   error
+		incomplete bool
+	}{
+		{"no failures", nil, nil, nil, false},
+		{"empty failures", []BackupFailure{}, nil, nil, false},
+		{"failures", failures, nil, nil, true},
+		{"failed upload", nil, errors.New("connection refused"), nil, true},
+		{"failures and failed upload", failures, errors.New("connection refused"), nil, true},
+		{"failed prune", nil, nil, errors.New("connection reset"), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := backupResult(test.failures, nil, test.uploadErr, test.pruneErr)
+			if errors.Is(err, ErrIncompleteBackup) != test.incomplete {
+				t.Errorf("got %v, want ErrIncompleteBackup: %t", err, test.incomplete)
+			}
+			if !test.incomplete && err != nil {
+				t.Errorf("got %v, want nil", err)
+			}
+			if test.uploadErr != nil && !errors.Is(err, test.uploadErr) {
+				t.Errorf("got %v, want it to wrap the upload error", err)
+			}
+			if test.pruneErr != nil && !errors.Is(err, test.pruneErr) {
+				t.Errorf("got %v, want it to wrap the prune error", err)
+			}
+		})
+	}
+}
@@ -2,11 +2,15 @@ package backup
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/charmbracelet/log"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/google/go-github/v63/github"
 )
@@ -26,18 +30,92 @@ type Repositories struct {
 func cloneRepository(repo *github.Repository, config BackupConfig) error {
 	// Set the output directory
 	outputDirectory := filepath.Join(config.Output, repo.GetFullName())
+	return cloneOrUpdate(repo.GetCloneURL(), outputDirectory, config)
+}
+
+// Clone a repository's wiki, which GitHub stores as a separate repository, next to the repository as `<repository>.wiki`.
+// Enabling the wiki doesn't create the repository until the first page is saved, so a missing wiki repository is skipped.
+func cloneWiki(repo *github.Repository, config BackupConfig) error {
+	if !repo.GetHasWiki() {
+		return nil
+	}
+	url := strings.TrimSuffix(repo.GetCloneURL(), ".git") + ".wiki.git"
+	outputDirectory := filepath.Join(config.Output, repo.GetFullName()+".wiki")
+	err := cloneOrUpdate(url, outputDirectory, config)
+	if errors.Is(err, transport.ErrRepositoryNotFound) || errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		log.Debug("Wiki is enabled but has no pages, skipping", "repository", repo.GetFullName())
+		return nil
+	}
+	return err
+}
+
+// Clone url into outputDirectory using the configured clone mode.
+// If updating and a repository already exists in outputDirectory, it is fetched into instead.
+func cloneOrUpdate(url string, outputDirectory string, config BackupConfig) error {
+	auth := &http.BasicAuth{
+		// Username: config.Username,
+		Username: config.Token,
+		Password: config.Token,
+	}
+
+	// If updating, fetch into the existing clone instead of cloning it again
+	if config.Update {
+		existing, err := git.PlainOpen(outputDirectory)
+		if err == nil {
+			log.Debug("Updating existing clone", "path", outputDirectory)
+			return config.Retry.Do(outputDirectory, func() error {
+				return fetchRepository(existing, auth)
+			}, nil)
+		} else if !errors.Is(err, git.ErrRepositoryNotExists) {
+			return err
+		}
+		log.Debug("No existing clone found, cloning", "path", outputDirectory)
+	}
+
+	// Start from the clone in the previous snapshot, if there is one, so only what changed is fetched and objects aren't stored twice
+	if config.Deduplicate && config.PreviousOutput != "" && !config.Update {
+		seeded, err := seedFromPrevious(outputDirectory, config, auth)
+		if seeded {
+			return nil
+		} else if err != nil {
+			log.Warn("Failed to reuse clone from previous snapshot, cloning from scratch", "path", outputDirectory, "err", err)
+		}
+	}
+
 	// Clone the repository
-	_, err := git.PlainClone(outputDirectory, false, &git.CloneOptions{
-		URL: repo.GetCloneURL(),
-		Auth: &http.BasicAuth{
-			// Username: config.Username,
-			Username: config.Token,
-			Password: config.Token,
-		},
-		SingleBranch:      false, // False by default
-		RecurseSubmodules: git.SubmoduleRescursivity(config.RecurseSubmodules),
+	// A mirror is a bare repository with every ref mapped 1:1, like `git clone --mirror`
+	mirror := config.CloneMode == "mirror"
+	// Only remove what a failed attempt left behind if the directory didn't exist beforehand
+	_, statErr := os.Stat(outputDirectory)
+	existed := statErr == nil
+	return config.Retry.Do(outputDirectory, func() error {
+		_, err := git.PlainClone(outputDirectory, mirror, &git.CloneOptions{
+			URL:          url,
+			Auth:         auth,
+			SingleBranch: false, // False by default
+			Mirror:       mirror,
+			// Ignored by go-git for mirrors since there is no worktree
+			RecurseSubmodules: git.SubmoduleRescursivity(config.RecurseSubmodules),
+		})
+		return err
+	}, func() {
+		if !existed {
+			os.RemoveAll(outputDirectory)
+		}
 	})
-	if err != nil {
+}
+
+// Fetch all refs and tags from origin into an existing repository.
+// Refs that were deleted or force-pushed upstream are pruned or overwritten locally.
+// The refspecs configured on the remote are used, so mirrors keep mapping every ref 1:1.
+func fetchRepository(repo *git.Repository, auth *http.BasicAuth) error {
+	err := repo.Fetch(&git.FetchOptions{
+		Auth:  auth,
+		Tags:  git.AllTags,
+		Prune: true,
+		Force: true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
 		return err
 	}
 	return nil
@@ -144,6 +222,26 @@ func GetRepositories(config *FetchConfig) (*Repositories, error) {
 
 }
 
+// Get the repositories owned by an organization, including private and internal ones if the token has access to them.
+// https://pkg.go.dev/github.com/google/go-github/v63@v63.0.0/github#RepositoriesService.ListByOrg
+func GetOrgRepositories(orgName string, client *github.Client) ([]*github.Repository, error) {
+	ctx := context.Background()
+	log.Info("Fetching repositories for organization", "org", orgName)
+
+	opt := &github.RepositoryListByOrgOptions{
+		Type:        "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	orgRepos, err := listAll(&opt.ListOptions, func() ([]*github.Repository, *github.Response, error) {
+		return client.Repositories.ListByOrg(ctx, orgName, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Fetched organization's repositories", "count", len(orgRepos), "org", orgName)
+	return orgRepos, nil
+}
+
 // Go through a list of repositories and remove duplicates.
 func RemoveDuplicateRepositories(repositories []*github.Repository,
 ) []*github.Repository {
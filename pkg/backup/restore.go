@@ -0,0 +1,286 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"filippo.io/age"
+	"github.com/charmbracelet/log"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/google/go-github/v63/github"
+)
+
+// ErrIncompleteRestore is returned by Restore when some repositories failed to restore
+var ErrIncompleteRestore = errors.New("restore incomplete")
+
+type RestoreConfig struct {
+	// Snapshot is a backup directory, or an archive of one
+	Snapshot string
+	// Identities decrypt the snapshot, or the repositories in it, if they are encrypted archives
+	Identities []age.Identity
+	// Repositories are the full names of the repositories to restore, as globs or regular expressions wrapped in slashes. Empty restores every repository.
+	Repositories []string
+	// Owner is the GitHub user or organization repositories are restored to. Empty for the authenticated user.
+	Owner string
+	// Token is used to create repositories on GitHub and push to them
+	Token string
+	// Private creates missing GitHub repositories as private
+	Private bool
+	// Remote is a URL to push to instead of GitHub, where `{owner}` and `{name}` are replaced with the owner and name of each repository, such as `git@gitlab.com:backups/{name}.git`.
+	// The repositories must already exist unless the server creates them on push.
+	Remote string
+	// RemoteToken authenticates to HTTP(S) remotes. SSH remotes use the SSH agent.
+	RemoteToken string
+	// DryRun prints what would be restored where without creating or pushing anything
+	DryRun bool
+	Retry  RetryPolicy
+}
+
+// A repository to restore and where to
+type restoreTarget struct {
+	entry ManifestEntry
+	owner string
+	name  string
+	url   string
+}
+
+// Restore pushes the branches and tags of repositories in a backup to GitHub or another remote.
+// On GitHub, repositories that don't exist are created, and the default branch is set to the one the repository had when it was backed up.
+func Restore(config RestoreConfig) error {
+	snapshot, cleanup, err := openSnapshot(config.Snapshot, config.Identities)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	entries, err := snapshotRepositories(snapshot)
+	if err != nil {
+		return err
+	}
+	entries, err = selectRepositories(entries, config.Repositories)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no repositories in %s match %v", config.Snapshot, config.Repositories)
+	}
+
+	var client *github.Client
+	owner := config.Owner
+	var ownerIsUser bool
+	if config.Remote == "" {
+		client, err = newGitHubClient(config.Token, config.Retry)
+		if err != nil {
+			return err
+		}
+		user, _, err := client.Users.Get(context.Background(), "")
+		if err != nil {
+			return err
+		}
+		if owner == "" {
+			owner = user.GetLogin()
+		}
+		ownerIsUser = strings.EqualFold(owner, user.GetLogin())
+	}
+
+	var targets []restoreTarget
+	for _, entry := range entries {
+		target := restoreTarget{entry: entry, owner: owner, name: path.Base(entry.Name)}
+		if target.owner == "" {
+			target.owner = path.Dir(entry.Name)
+		}
+		if config.Remote != "" {
+			target.url = strings.NewReplacer("{owner}", target.owner, "{name}", target.name).Replace(config.Remote)
+		} else {
+			target.url = fmt.Sprintf("https://github.com/%s/%s.git", target.owner, target.name)
+		}
+		targets = append(targets, target)
+	}
+
+	if config.DryRun {
+		return printRestoreTargets(os.Stdout, targets)
+	}
+
+	var failures []BackupFailure
+	failed := 0
+	for _, target := range targets {
+		log.Info("Restoring repository", "repository", target.entry.Name, "to", target.url)
+		err := restoreRepository(client, snapshot, target, ownerIsUser, config)
+		if err != nil {
+			log.Error("Failed to restore repository", "repository", target.entry.Name, "err", err)
+			failures = append(failures, failuresFromError(target.entry.Name, err)...)
+			failed++
+		}
+	}
+	if len(failures) > 0 {
+		printFailures(os.Stdout, failures)
+		return fmt.Errorf("%w: %d of %d repositories failed", ErrIncompleteRestore, failed, len(targets))
+	}
+	log.Info("Restored repositories", "count", len(targets))
+	return nil
+}
+
+// Keep the entries whose name matches one of the patterns. No patterns keeps every entry.
+func selectRepositories(entries []ManifestEntry, patterns []string) ([]ManifestEntry, error) {
+	if len(patterns) == 0 {
+		return entries, nil
+	}
+	matchers, err := compileNamePatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+	var selected []ManifestEntry
+	for _, entry := range entries {
+		if matchesAny(matchers, entry.Name) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected, nil
+}
+
+// Create the repository on GitHub if needed, push every branch and tag, and set the default branch.
+// client is nil when restoring to a remote other than GitHub.
+func restoreRepository(client *github.Client, snapshot string, target restoreTarget, ownerIsUser bool, config RestoreConfig) error {
+	if target.entry.Status == StatusFailed {
+		log.Warn("Repository failed to clone when it was backed up, restoring what was cloned", "repository", target.entry.Name)
+	}
+	dir, cleanup, err := openClone(snapshot, target.entry.Path, config.Identities)
+	if err != nil {
+		return withStage("open", err)
+	}
+	defer cleanup()
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return withStage("open", err)
+	}
+
+	var auth transport.AuthMethod
+	if client != nil {
+		err = ensureGitHubRepository(client, target, ownerIsUser, config.Private)
+		if err != nil {
+			return withStage("create", err)
+		}
+		auth = &githttp.BasicAuth{Username: config.Token, Password: config.Token}
+	} else if config.RemoteToken != "" && strings.HasPrefix(target.url, "http") {
+		auth = &githttp.BasicAuth{Username: config.RemoteToken, Password: config.RemoteToken}
+	}
+
+	err = config.Retry.Do(target.entry.Name, func() error {
+		return pushAllRefs(repo, target.url, auth)
+	}, nil)
+	if err != nil {
+		return withStage("push", err)
+	}
+
+	// GitHub makes the first branch pushed to an empty repository the default branch
+	if client != nil && target.entry.DefaultBranch != "" {
+		_, _, err = client.Repositories.Edit(context.Background(), target.owner, target.name, &github.Repository{
+			DefaultBranch: github.String(target.entry.DefaultBranch),
+		})
+		if err != nil {
+			return withStage("default-branch", err)
+		}
+	}
+	return nil
+}
+
+// Create a repository on GitHub unless it already exists
+func ensureGitHubRepository(client *github.Client, target restoreTarget, ownerIsUser bool, private bool) error {
+	ctx := context.Background()
+	_, resp, err := client.Repositories.Get(ctx, target.owner, target.name)
+	if err == nil {
+		log.Debug("Repository already exists, pushing to it", "repository", target.owner+"/"+target.name)
+		return nil
+	} else if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return err
+	}
+
+	// Repositories of the authenticated user are created without an organization
+	org := target.owner
+	if ownerIsUser {
+		org = ""
+	}
+	_, _, err = client.Repositories.Create(ctx, org, &github.Repository{
+		Name:    github.String(target.name),
+		Private: github.Bool(private),
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("Created repository", "repository", target.owner+"/"+target.name, "private", private)
+	return nil
+}
+
+// Push every branch and tag of a clone to url, overwriting what is there.
+// Checkouts only have the default branch as a local branch, so their remote-tracking branches are pushed as branches too.
+// Other refs, such as GitHub's `refs/pull/*` in mirrors, are left out as they can't be pushed.
+func pushAllRefs(repo *git.Repository, url string, auth transport.AuthMethod) error {
+	refs, err := repo.References()
+	if err != nil {
+		return err
+	}
+	// Map each destination to its source. Remote-tracking branches win over local branches, as they are what was fetched last.
+	sources := make(map[plumbing.ReferenceName]plumbing.ReferenceName)
+	remotePrefix := "refs/remotes/" + git.DefaultRemoteName + "/"
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		name := ref.Name()
+		switch {
+		case name.IsBranch(), name.IsTag():
+			if _, found := sources[name]; !found {
+				sources[name] = name
+			}
+		case strings.HasPrefix(name.String(), remotePrefix):
+			branch := strings.TrimPrefix(name.String(), remotePrefix)
+			if branch != "HEAD" {
+				sources[plumbing.NewBranchReferenceName(branch)] = name
+			}
+		}
+		return nil
+	})
+	refs.Close()
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		log.Warn("Repository has no branches or tags to push", "url", url)
+		return nil
+	}
+
+	var refSpecs []gitconfig.RefSpec
+	for dest, source := range sources {
+		refSpecs = append(refSpecs, gitconfig.RefSpec("+"+source.String()+":"+dest.String()))
+	}
+	remote := git.NewRemote(repo.Storer, &gitconfig.RemoteConfig{Name: "restore", URLs: []string{url}})
+	err = remote.Push(&git.PushOptions{
+		RemoteName: "restore",
+		RefSpecs:   refSpecs,
+		Auth:       auth,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+	return nil
+}
+
+func printRestoreTargets(w io.Writer, targets []restoreTarget) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tPATH\tTARGET")
+	for _, target := range targets {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", target.entry.Name, target.entry.Path, target.url)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+var testSignature = &object.Signature{Name: "Test", Email: "test@example.com", When: time.Unix(1700000000, 0)}
+
+// Create a repository at dir whose worktree is on main
+func newTestRepository(t *testing.T, dir string) *git.Repository {
+	t.Helper()
+	repo, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.Main},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// Commit to the branch HEAD points to. Parents are passed explicitly so commits can be made on other lines of history, such as to simulate a force push.
+func testCommit(t *testing.T, repo *git.Repository, message string, parents ...plumbing.Hash) plumbing.Hash {
+	t.Helper()
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := worktree.Commit(message, &git.CommitOptions{
+		Author:            testSignature,
+		Parents:           parents,
+		AllowEmptyCommits: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func setTestRef(t *testing.T, repo *git.Repository, name string, hash plumbing.Hash) {
+	t.Helper()
+	err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(name), hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Get every ref in a repository as `name hash`, sorted
+func testRefs(t *testing.T, repo *git.Repository) []string {
+	t.Helper()
+	refs, err := repo.References()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			found = append(found, ref.Name().String()+" "+ref.Hash().String())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(found)
+	return found
+}
+
+func TestPushAllRefs(t *testing.T) {
+	// A checkout clone only has the default branch as a local branch, and an outdated one if it was updated with a fetch
+	repo := newTestRepository(t, t.TempDir())
+	first := testCommit(t, repo, "first")
+	second := testCommit(t, repo, "second", first)
+	third := testCommit(t, repo, "third", second)
+	setTestRef(t, repo, "refs/heads/main", second)
+	setTestRef(t, repo, "refs/heads/local-only", first)
+	setTestRef(t, repo, "refs/remotes/origin/main", third)
+	setTestRef(t, repo, "refs/remotes/origin/feature", first)
+	err := repo.Storer.SetReference(plumbing.NewSymbolicReference("refs/remotes/origin/HEAD", "refs/remotes/origin/main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTestRef(t, repo, "refs/tags/v1", first)
+	annotated, err := repo.CreateTag("v2", second, &git.CreateTagOptions{Tagger: testSignature, Message: "v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Mirrors have pull request refs, which GitHub refuses
+	setTestRef(t, repo, "refs/pull/1/head", third)
+
+	remoteDir := t.TempDir()
+	remote, err := git.PlainInit(remoteDir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pushAllRefs(repo, remoteDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"refs/heads/feature " + first.String(),
+		"refs/heads/local-only " + first.String(),
+		"refs/heads/main " + third.String(),
+		"refs/tags/v1 " + first.String(),
+		"refs/tags/v2 " + annotated.Hash().String(),
+	}
+	if got := testRefs(t, remote); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Pushing again is a no-op rather than an error
+	err = pushAllRefs(repo, remoteDir, nil)
+	if err != nil {
+		t.Errorf("pushing again failed: %v", err)
+	}
+}
+
+func TestSelectRepositories(t *testing.T) {
+	entries := []ManifestEntry{{Name: "acme/api"}, {Name: "acme/web"}, {Name: "Acme/api-docs"}, {Name: "alice/api"}}
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{"no patterns selects everything", nil, []string{"acme/api", "acme/web", "Acme/api-docs", "alice/api"}},
+		{"exact name", []string{"acme/web"}, []string{"acme/web"}},
+		{"globs are case-insensitive", []string{"acme/api*"}, []string{"acme/api", "Acme/api-docs"}},
+		{"glob owner", []string{"*/api"}, []string{"acme/api", "alice/api"}},
+		{"regular expression", []string{`/^a.*\/api$/`}, []string{"acme/api", "alice/api"}},
+		{"regular expressions are case-sensitive", []string{`/^acme\//`}, []string{"acme/api", "acme/web"}},
+		{"several patterns", []string{"acme/web", `/docs$/`}, []string{"acme/web", "Acme/api-docs"}},
+		{"no match", []string{"bob/*"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, err := selectRepositories(entries, test.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range selected {
+				got = append(got, entry.Name)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if _, err := selectRepositories(entries, []string{"/(/"}); err == nil {
+		t.Error("expected an error for an invalid regular expression")
+	}
+}
+
+func TestRestoreRepositoryArchive(t *testing.T) {
+	// A backup written with archive-scope `repository`
+	snapshot := t.TempDir()
+	cloneDir := filepath.Join(snapshot, "acme", "api")
+	repo := newTestRepository(t, cloneDir)
+	first := testCommit(t, repo, "first")
+	setTestRef(t, repo, "refs/tags/v1", first)
+	want := testRefs(t, repo)
+
+	archive := cloneDir + utils.ArchiveExtensions["tar.zst"]
+	if err := utils.ArchiveDir(cloneDir, archive, "tar.zst"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(cloneDir); err != nil {
+		t.Fatal(err)
+	}
+	err := writeJSON(filepath.Join(snapshot, ManifestFile), &Manifest{
+		Repositories: []ManifestEntry{{Name: "acme/api", Path: "acme/api.tar.zst", Status: StatusOK}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remotes := t.TempDir()
+	remote, err := git.PlainInit(filepath.Join(remotes, "acme-api.git"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Restore(RestoreConfig{
+		Snapshot: snapshot,
+		Remote:   filepath.Join(remotes, "{owner}-{name}.git"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testRefs(t, remote); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
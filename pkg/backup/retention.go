@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/slashtechno/gobackup-github/pkg/storage"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+// PreviewRetention prints which backups the next backup of StartBackup would keep and remove, without removing anything.
+// Backups in the storage are included if one is configured.
+func PreviewRetention(config BackupConfig, maxBackups int, w io.Writer) error {
+	policy := config.Retention
+	policy.KeepLast = max(maxBackups, 1)
+	next := time.Now().Format(utils.TimeFormat)
+
+	parentDir := filepath.Clean(config.Output)
+	names, err := utils.ListBackups(parentDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	fmt.Fprintln(w, parentDir)
+	err = printRetention(w, policy.Apply(append(names, next)), next)
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.New(config.Storage)
+	if err != nil {
+		return err
+	}
+	if store != nil {
+		log.Info("Listing backups in storage", "storage", store)
+		names, err := store.List()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\n%s\n", store)
+		return printRetention(w, policy.Apply(append(names, next)), next)
+	}
+	return nil
+}
+
+// Print the decisions of a retention policy as a table, marking the backup that is about to start
+func printRetention(w io.Writer, decisions []utils.RetentionDecision, next string) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tACTION\tREASONS")
+	for _, decision := range decisions {
+		name, action := decision.Name, "remove"
+		if decision.Name == next {
+			name += " (next backup)"
+		}
+		if decision.Keep {
+			action = "keep"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", name, action, strings.Join(decision.Reasons, ", "))
+	}
+	return table.Flush()
+}
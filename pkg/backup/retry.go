@@ -0,0 +1,253 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/google/go-github/v63/github"
+)
+
+// RetryPolicy decides how often and how long to wait before retrying clones, fetches, and API calls that failed with a transient error.
+// The zero value doesn't retry.
+type RetryPolicy struct {
+	// Attempts is the total number of attempts, including the first one. Values below 1 are treated as 1.
+	Attempts int
+	// InitialBackoff is the time to wait before the first retry. It doubles for every retry after that.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the time to wait between attempts. 0 means no cap.
+	MaxBackoff time.Duration
+	// Jitter is the fraction (0 to 1) of each backoff that is randomized, so concurrent retries don't happen at the same time
+	Jitter float64
+	// Retryable decides if an error is transient. If nil, isRetryable is used.
+	Retryable func(error) bool
+}
+
+// Get the time to wait after the given (1-based) failed attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for range attempt - 1 {
+		if p.MaxBackoff > 0 && backoff >= p.MaxBackoff {
+			break
+		}
+		// Doubling would overflow for large attempt counts without MaxBackoff
+		if backoff > math.MaxInt64/2 {
+			backoff = math.MaxInt64
+			break
+		}
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if p.Jitter > 0 && backoff > 0 {
+		jitter := time.Duration(min(p.Jitter, 1) * float64(backoff))
+		// Converting a float that rounded past the largest duration overflows
+		if jitter < 0 || jitter > backoff {
+			jitter = backoff
+		}
+		// Randomize within jitter of the backoff, without going past the largest duration
+		low := backoff - jitter
+		high := backoff + min(jitter, math.MaxInt64-backoff)
+		if high > low {
+			backoff = low + time.Duration(rand.Int64N(int64(high-low)))
+		}
+	}
+	return backoff
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return isRetryable(err)
+}
+
+// Run operation until it succeeds, fails with an error that isn't retryable, or runs out of attempts.
+// beforeRetry, if not nil, is run before each retry, such as to clean up what a failed attempt left behind.
+// name is used in logs.
+func (p RetryPolicy) Do(name string, operation func() error, beforeRetry func()) error {
+	return p.DoContext(context.Background(), name, operation, beforeRetry)
+}
+
+// DoContext is Do, but stops waiting to retry once ctx is done, returning the last error.
+func (p RetryPolicy) DoContext(ctx context.Context, name string, operation func() error, beforeRetry func()) error {
+	attempts := max(p.Attempts, 1)
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = operation()
+		if err == nil || attempt == attempts || !p.retryable(err) {
+			return err
+		}
+		backoff := p.backoff(attempt)
+		log.Warn("Retrying after a transient error", "name", name, "attempt", attempt, "backoff", backoff, "err", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		if beforeRetry != nil {
+			beforeRetry()
+		}
+	}
+	return err
+}
+
+// Check if an error is likely to be transient: network errors, server errors (5xx), and being rate limited.
+// Errors like a repository not existing or authentication failing are not retried.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	for _, permanent := range []error{
+		transport.ErrRepositoryNotFound,
+		transport.ErrEmptyRemoteRepository,
+		transport.ErrAuthenticationRequired,
+		transport.ErrAuthorizationFailed,
+		transport.ErrInvalidAuthMethod,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+
+	var server *serverError
+	if errors.As(err, &server) {
+		return true
+	}
+	var errorResponse *github.ErrorResponse
+	if errors.As(err, &errorResponse) {
+		return errorResponse.Response != nil && isRetryableStatus(errorResponse.Response.StatusCode)
+	}
+	var rateLimitError *github.RateLimitError
+	var abuseRateLimitError *github.AbuseRateLimitError
+	if errors.As(err, &rateLimitError) || errors.As(err, &abuseRateLimitError) {
+		return true
+	}
+
+	// go-git wraps HTTP errors in an error that can't be unwrapped
+	var unexpected *plumbing.UnexpectedError
+	if errors.As(err, &unexpected) {
+		var httpErr *githttp.Err
+		if errors.As(unexpected.Err, &httpErr) {
+			return isRetryableStatus(httpErr.StatusCode())
+		}
+		err = unexpected.Err
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+func isRetryableStatus(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// An http.RoundTripper that retries idempotent requests that fail with network or server errors.
+// Rate limiting (403 and 429) is left to the rate limit waiter above it.
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+}
+
+// Whether sending a request more than once has the same effect as sending it once.
+// A POST, such as creating a repository, may have succeeded even if its response was a 502, so retrying it could fail or act twice.
+func isIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req.Method) {
+		return t.base.RoundTrip(req)
+	}
+	// Requests with a body can only be retried if the body can be read again
+	if req.Body != nil && req.GetBody == nil {
+		return t.base.RoundTrip(req)
+	}
+	if req.Body != nil {
+		// Each attempt sends a copy from GetBody, so the original body is never read
+		defer req.Body.Close()
+	}
+	var resp *http.Response
+	err := t.policy.DoContext(req.Context(), req.Method+" "+req.URL.Path, func() error {
+		attempt := req
+		if req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			attempt = req.Clone(req.Context())
+			attempt.Body = body
+		}
+		var err error
+		resp, err = t.base.RoundTrip(attempt)
+		if err != nil {
+			resp = nil
+			return err
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			// Keep the response in case this was the last attempt
+			return &serverError{resp: resp}
+		}
+		return nil
+	}, func() {
+		// The response of the failed attempt is being discarded
+		if resp != nil {
+			resp.Body.Close()
+			resp = nil
+		}
+	})
+
+	var server *serverError
+	if errors.As(err, &server) {
+		// Return the last response as is so the caller can handle the status
+		return server.resp, nil
+	}
+	return resp, err
+}
+
+// A server error response, so RetryPolicy.Do retries it
+type serverError struct {
+	resp *http.Response
+}
+
+func (e *serverError) Error() string {
+	return "server error: " + e.resp.Status
+}
+
+// Get an error for a response with an unexpected status.
+// Transient statuses, such as 502, are returned as a serverError so RetryPolicy.Do retries them.
+func unexpectedStatus(description string, resp *http.Response) error {
+	if isRetryableStatus(resp.StatusCode) {
+		return fmt.Errorf("%s: %w", description, &serverError{resp: resp})
+	}
+	return fmt.Errorf("%s: unexpected status %s", description, resp.Status)
+}
+
+// Create an HTTP client for API calls that retries transient failures according to the policy
+func newRetryClient(policy RetryPolicy) *http.Client {
+	return &http.Client{
+		Transport: &retryTransport{base: http.DefaultTransport, policy: policy},
+	}
+}
@@ -0,0 +1,242 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Minute}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{6, 32 * time.Second},
+		{7, time.Minute},
+		// Shifting by this much would overflow
+		{64, time.Minute},
+		{1000, time.Minute},
+	}
+	for _, test := range tests {
+		if got := policy.backoff(test.attempt); got != test.want {
+			t.Errorf("backoff(%d) = %s, want %s", test.attempt, got, test.want)
+		}
+	}
+
+	// Without MaxBackoff, large attempt counts stop at the largest duration instead of overflowing
+	uncapped := RetryPolicy{InitialBackoff: time.Second}
+	for _, attempt := range []int{40, 64, 1000} {
+		if got := uncapped.backoff(attempt); got != math.MaxInt64 {
+			t.Errorf("backoff(%d) without MaxBackoff = %s, want %s", attempt, got, time.Duration(math.MaxInt64))
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second, Jitter: 0.2}
+	for attempt := 1; attempt <= 10; attempt++ {
+		base := min(time.Second<<(attempt-1), 10*time.Second)
+		low, high := base-base/5, base+base/5
+		for range 100 {
+			if got := policy.backoff(attempt); got < low || got > high {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", attempt, got, low, high)
+			}
+		}
+	}
+
+	// A jitter of more than 1 is treated as 1, so the backoff is never negative
+	policy = RetryPolicy{InitialBackoff: time.Second, Jitter: 5}
+	for range 100 {
+		if got := policy.backoff(1); got < 0 || got > 2*time.Second {
+			t.Fatalf("backoff with a jitter of 5 = %s, want between 0 and 2s", got)
+		}
+	}
+
+	// Jitter on the largest duration doesn't overflow
+	policy = RetryPolicy{InitialBackoff: time.Second, Jitter: 1}
+	for range 100 {
+		if got := policy.backoff(1000); got < 0 {
+			t.Fatalf("backoff(1000) with jitter = %s, want a positive duration", got)
+		}
+	}
+}
+
+func TestDoContextCanceled(t *testing.T) {
+	policy := RetryPolicy{Attempts: 5, InitialBackoff: time.Hour, Retryable: func(error) bool { return true }}
+	ctx, cancel := context.WithCancel(context.Background())
+	failure := errors.New("transient")
+	attempts := 0
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	err := policy.DoContext(ctx, "test", func() error {
+		attempts++
+		return failure
+	}, nil)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s to return after the context was canceled", elapsed)
+	}
+	if !errors.Is(err, failure) {
+		t.Errorf("got error %v, want the last error of the operation", err)
+	}
+	if attempts != 1 {
+		t.Errorf("got %d attempts, want 1", attempts)
+	}
+}
+
+func TestDoRetries(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, Retryable: func(err error) bool { return err.Error() == "transient" }}
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"success", []error{nil}, 1, false},
+		{"transient then success", []error{errors.New("transient"), nil}, 2, false},
+		{"out of attempts", []error{errors.New("transient"), errors.New("transient"), errors.New("transient")}, 3, true},
+		{"permanent", []error{errors.New("permanent")}, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts, retries := 0, 0
+			err := policy.Do("test", func() error {
+				attempts++
+				return test.errs[attempts-1]
+			}, func() { retries++ })
+			if attempts != test.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, test.wantAttempts)
+			}
+			if retries != attempts-1 {
+				t.Errorf("beforeRetry ran %d times, want %d", retries, attempts-1)
+			}
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error: %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3}
+
+	t.Run("replays the body", func(t *testing.T) {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != "payload" {
+				t.Errorf("attempt %d got body %q, want %q", requests.Load()+1, body, "payload")
+			}
+			if requests.Add(1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		// NewRequest sets GetBody for strings.Reader
+		req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := newRetryClient(policy).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+		if got := requests.Load(); got != 3 {
+			t.Errorf("got %d requests, want 3", got)
+		}
+	})
+
+	t.Run("returns the last server error", func(t *testing.T) {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("unavailable"))
+		}))
+		defer server.Close()
+
+		resp, err := newRetryClient(policy).Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil {
+			t.Fatal("got a nil response after running out of attempts")
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+		}
+		// The body of the last response is still readable
+		if body, _ := io.ReadAll(resp.Body); string(body) != "unavailable" {
+			t.Errorf("got body %q, want %q", body, "unavailable")
+		}
+		if got := requests.Load(); got != 3 {
+			t.Errorf("got %d requests, want 3", got)
+		}
+	})
+
+	t.Run("client errors aren't retried", func(t *testing.T) {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		resp, err := newRetryClient(policy).Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := requests.Load(); got != 1 {
+			t.Errorf("got %d requests, want 1", got)
+		}
+	})
+
+	t.Run("non-idempotent requests aren't retried", func(t *testing.T) {
+		// Like creating a repository that succeeded even though the response was a 502
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := newRetryClient(policy).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadGateway {
+			t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusBadGateway)
+		}
+		if got := requests.Load(); got != 1 {
+			t.Errorf("got %d requests, want 1", got)
+		}
+	})
+}
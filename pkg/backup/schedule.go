@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule decides when StartBackup runs backups. If neither Interval nor Cron is set, a single backup is run.
+type Schedule struct {
+	// Interval is parsable by time.ParseDuration. Backups are run at start and then every interval after it.
+	Interval string
+	// Cron is a cron expression with five fields (minute, hour, day of month, month, day of week), such as `30 2 * * *` or `0 3 * * 1-5`, or a descriptor such as `@daily`.
+	// It is used instead of Interval if set, and the first backup is run at the first scheduled time rather than at start.
+	Cron string
+	// Timezone is the IANA name of the timezone Cron is evaluated in, such as `Europe/Berlin`. Empty for local time.
+	Timezone string
+}
+
+// IsEmpty reports whether the schedule only runs a single backup
+func (s Schedule) IsEmpty() bool {
+	return s.Interval == "" && s.Cron == ""
+}
+
+func (s Schedule) String() string {
+	if s.Cron == "" {
+		return "every " + s.Interval
+	}
+	if s.Timezone == "" {
+		return s.Cron
+	}
+	return fmt.Sprintf("%s (%s)", s.Cron, s.Timezone)
+}
+
+// Validate checks for settings that would otherwise be ignored
+func (s Schedule) Validate() error {
+	if s.Timezone != "" && s.Cron == "" {
+		return fmt.Errorf("timezone %s is set without cron; it only applies to cron expressions", s.Timezone)
+	}
+	return nil
+}
+
+// Parse the schedule into the times backups are run at. Intervals are counted from start.
+func (s Schedule) parse(start time.Time) (cron.Schedule, error) {
+	if s.Cron == "" {
+		interval, err := time.ParseDuration(s.Interval)
+		if err != nil {
+			return nil, err
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("interval must be greater than 0: %s", s.Interval)
+		}
+		return intervalSchedule{start: start, interval: interval}, nil
+	}
+
+	spec := s.Cron
+	if s.Timezone != "" {
+		// Check the timezone here, as the cron parser's error for an unknown one is less clear
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %s: %w", s.Timezone, err)
+		}
+		spec = "CRON_TZ=" + s.Timezone + " " + spec
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %s: %w", s.Cron, err)
+	}
+	return schedule, nil
+}
+
+// A schedule that runs every interval after start, so backups don't drift by how long each one takes.
+// If a backup takes longer than the interval, the runs it overlapped are skipped.
+type intervalSchedule struct {
+	start    time.Time
+	interval time.Duration
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	if t.Before(s.start) {
+		return s.start
+	}
+	elapsed := t.Sub(s.start) / s.interval
+	return s.start.Add((elapsed + 1) * s.interval)
+}
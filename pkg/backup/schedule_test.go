@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntervalScheduleNext(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	schedule := intervalSchedule{start: start, interval: time.Hour}
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"before start", start.Add(-time.Minute), start},
+		{"at start", start, start.Add(time.Hour)},
+		{"during the first interval", start.Add(10 * time.Minute), start.Add(time.Hour)},
+		{"at a scheduled time", start.Add(time.Hour), start.Add(2 * time.Hour)},
+		// A backup that took longer than the interval skips the runs it overlapped instead of drifting
+		{"after a long backup", start.Add(3*time.Hour + 5*time.Minute), start.Add(4 * time.Hour)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := schedule.Next(test.t); !got.Equal(test.want) {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		wantErr  bool
+	}{
+		{"empty", Schedule{}, false},
+		{"interval", Schedule{Interval: "24h"}, false},
+		{"cron with timezone", Schedule{Cron: "30 2 * * *", Timezone: "Europe/Berlin"}, false},
+		{"timezone without cron", Schedule{Interval: "24h", Timezone: "Europe/Berlin"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.schedule.Validate()
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error: %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleParse(t *testing.T) {
+	// 2024-01-31 23:00 UTC is already 2024-02-01 00:00 in Berlin
+	now := time.Date(2024, 1, 31, 23, 0, 0, 0, time.UTC)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("timezone database not available:", err)
+	}
+	tests := []struct {
+		name     string
+		schedule Schedule
+		want     time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "interval counts from start",
+			schedule: Schedule{Interval: "6h"},
+			want:     now.Add(6 * time.Hour),
+		},
+		{
+			name:     "cron in UTC",
+			schedule: Schedule{Cron: "30 2 * * *", Timezone: "UTC"},
+			want:     time.Date(2024, 2, 1, 2, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "cron in a timezone",
+			schedule: Schedule{Cron: "30 2 * * *", Timezone: "Europe/Berlin"},
+			want:     time.Date(2024, 2, 1, 2, 30, 0, 0, berlin),
+		},
+		{
+			name:     "descriptor in a timezone",
+			schedule: Schedule{Cron: "@daily", Timezone: "Europe/Berlin"},
+			want:     time.Date(2024, 2, 2, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:     "cron takes precedence over interval",
+			schedule: Schedule{Interval: "6h", Cron: "0 * * * *", Timezone: "UTC"},
+			want:     now.Add(time.Hour),
+		},
+		{name: "invalid interval", schedule: Schedule{Interval: "daily"}, wantErr: true},
+		{name: "interval of 0", schedule: Schedule{Interval: "0s"}, wantErr: true},
+		{name: "invalid cron", schedule: Schedule{Cron: "* * *"}, wantErr: true},
+		{name: "invalid timezone", schedule: Schedule{Cron: "30 2 * * *", Timezone: "Mars/Olympus_Mons"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runs, err := test.schedule.parse(now)
+			if test.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := runs.Next(now); !got.Equal(test.want) {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/charmbracelet/log"
+	"github.com/go-git/go-git/v5"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+// Open a backup that is either a directory or an archive (such as one written with archive-scope `snapshot`).
+// Archives are extracted to a temporary directory, which cleanup removes.
+func openSnapshot(path string, identities []age.Identity) (dir string, cleanup func(), err error) {
+	if _, isArchive := utils.TrimArchiveExtension(path); !isArchive {
+		return path, func() {}, nil
+	}
+	return extractTemporarily(path, identities)
+}
+
+// Open a clone in a backup directory. path is relative to the backup directory, like ManifestEntry.Path, and can be an archive (such as one written with archive-scope `repository`).
+func openClone(snapshot string, path string, identities []age.Identity) (dir string, cleanup func(), err error) {
+	fullPath := filepath.Join(snapshot, path)
+	if _, isArchive := utils.TrimArchiveExtension(path); !isArchive {
+		return fullPath, func() {}, nil
+	}
+	return extractTemporarily(fullPath, identities)
+}
+
+func extractTemporarily(archive string, identities []age.Identity) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "gobackup-github-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	log.Debug("Extracting archive", "archive", archive, "path", dir)
+	err = utils.ExtractArchive(archive, dir, identities...)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+// Get the repositories in a backup directory from its manifest.
+// Backups from before manifests were written are searched for clones at `<owner>/<repository>` instead.
+func snapshotRepositories(dir string) ([]ManifestEntry, error) {
+	manifest, err := ReadManifest(dir)
+	if err == nil {
+		return manifest.Repositories, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	log.Warn("Backup has no manifest, searching it for repositories", "path", dir)
+	owners, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []ManifestEntry
+	for _, owner := range owners {
+		// Directories such as `_metadata` and `_gists` aren't owners
+		if !owner.IsDir() || strings.HasPrefix(owner.Name(), "_") {
+			continue
+		}
+		repos, err := os.ReadDir(filepath.Join(dir, owner.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range repos {
+			name := owner.Name() + "/" + repo.Name()
+			if !repo.IsDir() || strings.HasSuffix(name, ".wiki") {
+				continue
+			}
+			if _, err := git.PlainOpen(filepath.Join(dir, name)); err != nil {
+				continue
+			}
+			entries = append(entries, ManifestEntry{Name: name, Path: name, Status: StatusOK})
+		}
+	}
+	return entries, nil
+}
+
+// LatestSnapshot finds the backup to use when none is given: output itself if it is a backup (such as one written by `gobackup-github backup`), otherwise the most recent timestamped backup in it (such as one written by `gobackup-github backup continuous`).
+func LatestSnapshot(output string) (string, error) {
+	if _, err := os.Stat(filepath.Join(output, ManifestFile)); err == nil {
+		return output, nil
+	}
+	backups, err := timestampedBackups(output)
+	if err != nil {
+		return "", err
+	}
+	if len(backups) == 0 {
+		return "", fmt.Errorf("no backups found in %s", output)
+	}
+	return filepath.Join(output, backups[0].Name), nil
+}
+
+// Find the timestamped backups in output, from the most recent to the oldest
+func timestampedBackups(output string) ([]utils.RetentionDecision, error) {
+	names, err := utils.ListBackups(output)
+	if err != nil {
+		return nil, err
+	}
+	// Apply sorts from the most recent backup and leaves out names that aren't timestamps
+	return utils.RetentionPolicy{}.Apply(names), nil
+}
@@ -0,0 +1,234 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"filippo.io/age"
+	"github.com/charmbracelet/log"
+	"github.com/dustin/go-humanize"
+	"github.com/slashtechno/gobackup-github/pkg/storage"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+// Snapshot is a timestamped backup in the output directory of `gobackup-github backup continuous`
+type Snapshot struct {
+	// ID is the name of the backup directory or archive
+	ID   string
+	Path string
+	Time time.Time
+	// Manifest is nil if the backup has no manifest, or it can't be read, such as when the backup is encrypted and no identity was given
+	Manifest *Manifest
+	// Size in bytes of the directory or archive
+	Size int64
+}
+
+// Status of the backup from its manifest, or why it is unknown
+func (s Snapshot) Status() string {
+	switch {
+	case s.Manifest != nil:
+		return s.Manifest.Status
+	case strings.HasSuffix(s.ID, utils.EncryptedExtension):
+		return "encrypted"
+	default:
+		return "unknown"
+	}
+}
+
+// ListSnapshots finds the backups in output, from the most recent to the oldest.
+// Encrypted archives are only read if identities are given.
+func ListSnapshots(output string, identities []age.Identity) ([]Snapshot, error) {
+	backups, err := timestampedBackups(output)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []Snapshot
+	for _, backup := range backups {
+		snapshot := Snapshot{ID: backup.Name, Path: filepath.Join(output, backup.Name), Time: backup.Time}
+		snapshot.Size, err = utils.DirSize(snapshot.Path)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Manifest, err = readSnapshotManifest(snapshot.Path, identities)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Warn("Failed to read manifest", "snapshot", snapshot.ID, "err", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// Find a snapshot by its ID, or a prefix of it that only one snapshot has, such as `2024-01-01` if there was a single backup that day
+func FindSnapshot(output string, id string, identities []age.Identity) (Snapshot, error) {
+	snapshots, err := ListSnapshots(output, identities)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var matches []Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.ID == id {
+			return snapshot, nil
+		}
+		if strings.HasPrefix(snapshot.ID, id) {
+			matches = append(matches, snapshot)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Snapshot{}, fmt.Errorf("no snapshot %s in %s", id, output)
+	case 1:
+		return matches[0], nil
+	default:
+		return Snapshot{}, fmt.Errorf("%s matches %d snapshots; use more of the timestamp", id, len(matches))
+	}
+}
+
+// Read the manifest of a backup directory, or of an archive without extracting it, as ArchiveDir writes the manifest first
+func readSnapshotManifest(path string, identities []age.Identity) (*Manifest, error) {
+	if _, isArchive := utils.TrimArchiveExtension(path); !isArchive {
+		return ReadManifest(path)
+	}
+	if strings.HasSuffix(path, utils.EncryptedExtension) && len(identities) == 0 {
+		return nil, nil
+	}
+	tarReader, closeArchive, err := utils.OpenArchive(path, identities...)
+	if err != nil {
+		return nil, err
+	}
+	defer closeArchive()
+	header, err := tarReader.Next()
+	if err != nil {
+		return nil, err
+	}
+	if header.Name != ManifestFile {
+		return nil, fs.ErrNotExist
+	}
+	manifest := &Manifest{}
+	err = json.NewDecoder(tarReader).Decode(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ManifestFile, err)
+	}
+	return manifest, nil
+}
+
+// PrintSnapshots prints a table of snapshots
+func PrintSnapshots(w io.Writer, snapshots []Snapshot) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tTIME\tREPOSITORIES\tGISTS\tSIZE\tSTATUS")
+	for _, snapshot := range snapshots {
+		repositories, gists := "-", "-"
+		if snapshot.Manifest != nil {
+			repositories = fmt.Sprint(len(snapshot.Manifest.Repositories))
+			gists = fmt.Sprint(len(snapshot.Manifest.Gists))
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			snapshot.ID,
+			snapshot.Time.Format(time.DateTime),
+			repositories,
+			gists,
+			humanize.IBytes(uint64(snapshot.Size)),
+			snapshot.Status(),
+		)
+	}
+	return table.Flush()
+}
+
+// PrintSnapshot prints the details of a snapshot and each repository and gist in it
+func PrintSnapshot(w io.Writer, snapshot Snapshot) error {
+	manifest := snapshot.Manifest
+	if manifest == nil {
+		return fmt.Errorf("snapshot %s has no manifest, or it can't be read (is it encrypted?)", snapshot.ID)
+	}
+	fmt.Fprintf(w, "ID:          %s\n", snapshot.ID)
+	fmt.Fprintf(w, "Path:        %s\n", snapshot.Path)
+	fmt.Fprintf(w, "Started:     %s\n", manifest.StartedAt.Format(time.DateTime))
+	fmt.Fprintf(w, "Finished:    %s (took %s)\n", manifest.FinishedAt.Format(time.DateTime), manifest.FinishedAt.Sub(manifest.StartedAt).Round(time.Second))
+	fmt.Fprintf(w, "Clone mode:  %s\n", manifest.CloneMode)
+	fmt.Fprintf(w, "Status:      %s\n", manifest.Status)
+	fmt.Fprintf(w, "Size:        %s on disk, %s of clones\n\n", humanize.IBytes(uint64(snapshot.Size)), humanize.IBytes(uint64(manifest.Size)))
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tSOURCES\tSTATUS\tREFS\tSIZE\tDURATION\tFAILED STAGES")
+	printEntries := func(entries []ManifestEntry) {
+		for _, entry := range entries {
+			var stages []string
+			for _, failure := range entry.Failures {
+				stages = append(stages, failure.Stage)
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+				entry.Name,
+				strings.Join(entry.Sources, ", "),
+				entry.Status,
+				len(entry.Refs),
+				humanize.IBytes(uint64(entry.Size)),
+				entry.Duration.Round(time.Millisecond),
+				strings.Join(stages, ", "),
+			)
+		}
+	}
+	printEntries(manifest.Repositories)
+	printEntries(manifest.Gists)
+	return table.Flush()
+}
+
+// PruneSnapshots removes the backups in the output directory, and the storage if one is configured, that the retention policy doesn't keep.
+// Unlike when rolling directories, there is no backup about to start, so the most recent backup counts as the most recent one.
+// With dryRun, what would be removed is printed instead.
+func PruneSnapshots(config BackupConfig, maxBackups int, dryRun bool, w io.Writer) error {
+	policy := config.Retention
+	policy.KeepLast = max(maxBackups, 1)
+
+	output := filepath.Clean(config.Output)
+	names, err := utils.ListBackups(output)
+	if err != nil {
+		return err
+	}
+	err = pruneNames(output, policy.Apply(names), dryRun, w, func(name string) error {
+		return os.RemoveAll(filepath.Join(output, name))
+	})
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.New(config.Storage)
+	if err != nil || store == nil {
+		return err
+	}
+	names, err = store.List()
+	if err != nil {
+		return err
+	}
+	return pruneNames(store.String(), policy.Apply(names), dryRun, w, store.Remove)
+}
+
+// Remove the backups a retention policy doesn't keep, or print the decisions with dryRun
+func pruneNames(location string, decisions []utils.RetentionDecision, dryRun bool, w io.Writer, remove func(name string) error) error {
+	if dryRun {
+		fmt.Fprintln(w, location)
+		err := printRetention(w, decisions, "")
+		fmt.Fprintln(w)
+		return err
+	}
+	removed := 0
+	for _, decision := range decisions {
+		if decision.Keep {
+			continue
+		}
+		err := remove(decision.Name)
+		if err != nil {
+			return err
+		}
+		removed++
+		log.Info("Removed backup not kept by the retention policy", "location", location, "name", decision.Name)
+	}
+	log.Info("Pruned backups", "location", location, "removed", removed, "kept", len(decisions)-removed)
+	return nil
+}
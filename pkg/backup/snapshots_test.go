@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+// Create a backup directory for each name, or an empty file for names of archives
+func newTestSnapshots(t *testing.T, names ...string) string {
+	t.Helper()
+	output := t.TempDir()
+	for _, name := range names {
+		var err error
+		if _, isArchive := utils.TrimArchiveExtension(name); isArchive {
+			err = os.WriteFile(filepath.Join(output, name), nil, 0644)
+		} else {
+			err = os.Mkdir(filepath.Join(output, name), 0755)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return output
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	names := []string{
+		"2024-01-01-00-00-00",
+		"2024-01-15-00-00-00.tar.zst",
+		"2024-02-01-00-00-00",
+		"2024-02-01-12-00-00",
+		"2024-02-02-00-00-00",
+		"not-a-snapshot",
+	}
+	tests := []struct {
+		name       string
+		maxBackups int
+		retention  utils.RetentionPolicy
+		want       []string
+	}{
+		{
+			name:       "max backups",
+			maxBackups: 2,
+			want:       []string{"2024-02-01-12-00-00", "2024-02-02-00-00-00", "not-a-snapshot"},
+		},
+		{
+			name:       "at least one snapshot is kept",
+			maxBackups: 0,
+			want:       []string{"2024-02-02-00-00-00", "not-a-snapshot"},
+		},
+		{
+			name:       "retention policy",
+			maxBackups: 1,
+			retention:  utils.RetentionPolicy{KeepMonthly: 3},
+			want:       []string{"2024-01-15-00-00-00.tar.zst", "2024-02-02-00-00-00", "not-a-snapshot"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := newTestSnapshots(t, names...)
+			config := BackupConfig{Output: output, Retention: test.retention}
+
+			// A dry run only prints what would be removed
+			var preview bytes.Buffer
+			err := PruneSnapshots(config, test.maxBackups, true, &preview)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := listTestSnapshots(t, output); !slices.Equal(got, names) {
+				t.Errorf("dry run removed snapshots: %v", got)
+			}
+			if !strings.Contains(preview.String(), "remove") {
+				t.Errorf("dry run didn't print anything to remove:\n%s", preview.String())
+			}
+
+			err = PruneSnapshots(config, test.maxBackups, false, &preview)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := listTestSnapshots(t, output); !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func listTestSnapshots(t *testing.T, output string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestFindSnapshot(t *testing.T) {
+	output := newTestSnapshots(t, "2024-01-01-00-00-00", "2024-01-02-00-00-00", "2024-01-02-12-00-00.tar.gz")
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"2024-01-01-00-00-00", "2024-01-01-00-00-00"},
+		{"2024-01-01", "2024-01-01-00-00-00"},
+		{"2024-01-02-12", "2024-01-02-12-00-00.tar.gz"},
+		// Ambiguous
+		{"2024-01-02", ""},
+		{"2023", ""},
+	}
+	for _, test := range tests {
+		snapshot, err := FindSnapshot(output, test.id, nil)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", test.id, snapshot.Path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.id, err)
+		} else if filepath.Base(snapshot.Path) != test.want {
+			t.Errorf("%s: got %s, want %s", test.id, snapshot.Path, test.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/slashtechno/gobackup-github/pkg/storage"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+// Upload a finished backup (a directory or an archive) to the configured storage, named after its base name.
+// Unless KeepLocal is set, the local copy is removed afterwards. When updating, the local clones are always kept so they can be fetched into next time.
+func uploadBackup(store storage.Storage, config BackupConfig, path string) error {
+	name := filepath.Base(path)
+	log.Info("Uploading backup", "path", path, "storage", store)
+	err := store.Upload(path, name)
+	if err != nil {
+		return err
+	}
+	log.Info("Uploaded backup", "storage", store, "name", name)
+	if config.Storage.KeepLocal || config.Update {
+		return nil
+	}
+	return os.RemoveAll(path)
+}
+
+// Remove the backups in the storage that the retention policy doesn't keep, like utils.RollingDir does for the local output directory.
+// The backup that is about to start counts as the most recent one.
+func pruneStorage(store storage.Storage, policy utils.RetentionPolicy) error {
+	names, err := store.List()
+	if err != nil {
+		return fmt.Errorf("listing backups in %s: %w", store, err)
+	}
+	next := time.Now().Format(utils.TimeFormat)
+	for _, decision := range policy.Apply(append(names, next)) {
+		if decision.Keep {
+			continue
+		}
+		err := store.Remove(decision.Name)
+		if err != nil {
+			return fmt.Errorf("removing %s from %s: %w", decision.Name, store, err)
+		}
+		log.Info("Removed backup not kept by the retention policy from storage", "storage", store, "name", decision.Name)
+	}
+	return nil
+}
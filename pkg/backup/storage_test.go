@@ -0,0 +1,71 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+// A storage whose List or Remove fail, like one that can't be reached
+type failingStorage struct {
+	names     []string
+	listErr   error
+	removeErr error
+}
+
+func (s *failingStorage) Upload(localPath string, name string) error { return nil }
+
+func (s *failingStorage) List() ([]string, error) { return s.names, s.listErr }
+
+func (s *failingStorage) Remove(name string) error { return s.removeErr }
+
+func (s *failingStorage) String() string { return "failing://backups" }
+
+func TestRollingDirStoragePruneFailure(t *testing.T) {
+	unreachable := errors.New("connection refused")
+	tests := []struct {
+		name  string
+		store *failingStorage
+	}{
+		{"list fails", &failingStorage{listErr: unreachable}},
+		{"remove fails", &failingStorage{names: []string{"2024-01-01-00-00-00", "2024-01-02-00-00-00"}, removeErr: unreachable}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parentDir := newTestSnapshots(t, "2024-01-01-00-00-00", "2024-01-02-00-00-00")
+			config := BackupConfig{RunType: "clone", Output: parentDir}
+
+			dir, pruneErr, err := rollingDirIfNotDryRun(config, test.store, utils.RetentionPolicy{KeepLast: 2}, parentDir)
+			if err != nil {
+				t.Fatalf("got %v, want the backup to continue", err)
+			}
+			if !errors.Is(pruneErr, unreachable) {
+				t.Errorf("got prune error %v, want it to wrap %v", pruneErr, unreachable)
+			}
+			// The local backups are still rolled
+			if _, err := os.Stat(dir); err != nil {
+				t.Errorf("expected the next backup directory to be created: %v", err)
+			}
+			names, err := utils.ListBackups(parentDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"2024-01-02-00-00-00", filepath.Base(dir)}; !slices.Equal(names, want) {
+				t.Errorf("got local backups %q, want %q", names, want)
+			}
+
+			// The next backup reports the failure instead of stopping
+			failures := withPruneFailure(nil, test.store, pruneErr)
+			if len(failures) != 1 || failures[0].Stage != "prune" || failures[0].Name != "failing://backups" {
+				t.Errorf("got failures %+v, want a prune failure for the storage", failures)
+			}
+			if err := backupResult(nil, test.store, nil, pruneErr); !errors.Is(err, ErrIncompleteBackup) {
+				t.Errorf("got %v, want ErrIncompleteBackup so continuous backups keep running", err)
+			}
+		})
+	}
+}
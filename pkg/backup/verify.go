@@ -0,0 +1,238 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"filippo.io/age"
+	"github.com/charmbracelet/log"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// ErrCorruptBackup is returned by Verify when some repositories or gists in a backup are missing, corrupt, or don't match the manifest
+var ErrCorruptBackup = errors.New("backup has problems")
+
+// VerifyResult is what was wrong with a repository or gist in a backup, if anything
+type VerifyResult struct {
+	Name     string
+	Path     string
+	Problems []string
+}
+
+// Verify checks that every repository and gist in a backup can be restored, and prints a table of the ones that can't.
+// Every object reachable from a ref must exist and match its hash, and every ref must point to the commit recorded in the manifest.
+// snapshot is a backup directory or an archive of one.
+func Verify(snapshot string, identities []age.Identity, w io.Writer) error {
+	dir, cleanup, err := openSnapshot(snapshot, identities)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var entries []ManifestEntry
+	manifest, err := ReadManifest(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		// Refs can't be compared without a manifest, but the objects can still be checked
+		entries, err = snapshotRepositories(dir)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		entries = append(manifest.Repositories, manifest.Gists...)
+	}
+
+	var results []VerifyResult
+	for _, entry := range entries {
+		log.Info("Verifying", "name", entry.Name)
+		result := VerifyResult{Name: entry.Name, Path: entry.Path, Problems: verifyEntry(dir, entry, identities)}
+		for _, problem := range result.Problems {
+			log.Error("Problem found", "name", entry.Name, "problem", problem)
+		}
+		results = append(results, result)
+	}
+
+	problems := slices.DeleteFunc(results, func(result VerifyResult) bool {
+		return len(result.Problems) == 0
+	})
+	if len(problems) > 0 {
+		printVerifyResults(w, problems)
+		return fmt.Errorf("%w: %d of %d repositories and gists", ErrCorruptBackup, len(problems), len(entries))
+	}
+	log.Info("Backup verified", "repositories and gists", len(entries))
+	return nil
+}
+
+// Check a single repository or gist, returning what is wrong with it
+func verifyEntry(snapshot string, entry ManifestEntry, identities []age.Identity) []string {
+	if entry.Status == StatusFailed {
+		return []string{"failed to clone when it was backed up"}
+	}
+	dir, cleanup, err := openClone(snapshot, entry.Path, identities)
+	if err != nil {
+		return []string{fmt.Sprintf("can't be opened: %v", err)}
+	}
+	defer cleanup()
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return []string{fmt.Sprintf("missing or not a repository: %v", err)}
+	}
+
+	var problems []string
+	// Entries from backups without a manifest have no refs to compare to
+	if entry.Refs != nil {
+		refs, err := readRefs(dir)
+		if err != nil {
+			return []string{fmt.Sprintf("refs can't be read: %v", err)}
+		}
+		problems = append(problems, compareRefs(entry.Refs, refs)...)
+	}
+	return append(problems, checkObjects(repo)...)
+}
+
+// Compare the refs recorded in a manifest to the refs of the clone
+func compareRefs(recorded map[string]string, found map[string]string) []string {
+	var problems []string
+	for name, hash := range recorded {
+		current, ok := found[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("ref %s is missing", name))
+		} else if current != hash {
+			problems = append(problems, fmt.Sprintf("ref %s points to %s instead of %s", name, current, hash))
+		}
+	}
+	for name := range found {
+		if _, ok := recorded[name]; !ok {
+			problems = append(problems, fmt.Sprintf("ref %s isn't in the manifest", name))
+		}
+	}
+	slices.Sort(problems)
+	return problems
+}
+
+// Walk every object reachable from a ref, checking that it exists and that its content matches its hash, like `git fsck --connectivity-only` and `git fsck` combined.
+// Returns the first problems found; a single missing object can make many others unreachable, so the walk stops after a few.
+func checkObjects(repo *git.Repository) []string {
+	const maxProblems = 10
+	var problems []string
+	seen := make(map[plumbing.Hash]bool)
+	var pending []plumbing.Hash
+
+	refs, err := repo.References()
+	if err != nil {
+		return []string{fmt.Sprintf("refs can't be read: %v", err)}
+	}
+	refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			pending = append(pending, ref.Hash())
+		}
+		return nil
+	})
+	refs.Close()
+
+	for len(pending) > 0 && len(problems) < maxProblems {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		encoded, err := repo.Storer.EncodedObject(plumbing.AnyObject, hash)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			problems = append(problems, fmt.Sprintf("object %s is missing", hash))
+			continue
+		} else if err != nil {
+			problems = append(problems, fmt.Sprintf("object %s can't be read: %v", hash, err))
+			continue
+		}
+		err = checkHash(hash, encoded)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+
+		children, err := objectChildren(repo.Storer, encoded)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("object %s can't be decoded: %v", hash, err))
+			continue
+		}
+		pending = append(pending, children...)
+	}
+	if len(problems) >= maxProblems {
+		problems = append(problems, "stopped checking objects after too many problems")
+	}
+	return problems
+}
+
+// Check that an object's content hashes to the hash it was looked up by.
+// The object's own hash isn't used, as loose objects are hashed as they are read rather than trusting their file name.
+func checkHash(hash plumbing.Hash, encoded plumbing.EncodedObject) error {
+	reader, err := encoded.Reader()
+	if err != nil {
+		return fmt.Errorf("object %s can't be read: %w", hash, err)
+	}
+	defer reader.Close()
+	hasher := plumbing.NewHasher(encoded.Type(), encoded.Size())
+	_, err = io.Copy(hasher, reader)
+	if err != nil {
+		return fmt.Errorf("object %s can't be read: %w", hash, err)
+	}
+	if sum := hasher.Sum(); sum != hash {
+		return fmt.Errorf("object %s is corrupt; its content hashes to %s", hash, sum)
+	}
+	return nil
+}
+
+// Get the objects an object refers to: a commit's tree and parents, a tree's entries, or a tag's target
+func objectChildren(s storer.EncodedObjectStorer, encoded plumbing.EncodedObject) ([]plumbing.Hash, error) {
+	switch encoded.Type() {
+	case plumbing.CommitObject:
+		commit, err := object.DecodeCommit(s, encoded)
+		if err != nil {
+			return nil, err
+		}
+		return append([]plumbing.Hash{commit.TreeHash}, commit.ParentHashes...), nil
+	case plumbing.TreeObject:
+		tree, err := object.DecodeTree(s, encoded)
+		if err != nil {
+			return nil, err
+		}
+		var children []plumbing.Hash
+		for _, entry := range tree.Entries {
+			// Submodules point to commits in other repositories
+			if entry.Mode != filemode.Submodule {
+				children = append(children, entry.Hash)
+			}
+		}
+		return children, nil
+	case plumbing.TagObject:
+		tag, err := object.DecodeTag(s, encoded)
+		if err != nil {
+			return nil, err
+		}
+		return []plumbing.Hash{tag.Target}, nil
+	}
+	return nil, nil
+}
+
+func printVerifyResults(w io.Writer, results []VerifyResult) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tPATH\tPROBLEM")
+	for _, result := range results {
+		for _, problem := range result.Problems {
+			fmt.Fprintf(table, "%s\t%s\t%s\n", result.Name, result.Path, strings.ReplaceAll(problem, "\t", " "))
+		}
+	}
+	return table.Flush()
+}
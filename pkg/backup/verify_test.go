@@ -0,0 +1,195 @@
+package backup
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/slashtechno/gobackup-github/pkg/utils"
+)
+
+// A backup directory with a single clone at `acme/api`, along with what is needed to damage it
+type verifySnapshot struct {
+	dir      string
+	clone    string
+	repo     *git.Repository
+	manifest *Manifest
+	// The commits on main, from the oldest
+	commits []plumbing.Hash
+	// The blob of README.md in the first commit
+	readme plumbing.Hash
+}
+
+func newVerifySnapshot(t *testing.T) *verifySnapshot {
+	t.Helper()
+	s := &verifySnapshot{dir: filepath.Join(t.TempDir(), "2024-01-01-00-00-00")}
+	s.clone = filepath.Join(s.dir, "acme", "api")
+	s.repo = newTestRepository(t, s.clone)
+	if err := os.WriteFile(filepath.Join(s.clone, "README.md"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := s.repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add("README.md"); err != nil {
+		t.Fatal(err)
+	}
+	first := testCommit(t, s.repo, "first")
+	second := testCommit(t, s.repo, "second", first)
+	setTestRef(t, s.repo, "refs/tags/v1", first)
+	s.commits = []plumbing.Hash{first, second}
+	commit, err := s.repo.CommitObject(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := commit.File("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.readme = file.Hash
+
+	entry := newManifestEntry("acme/api", s.dir, "acme/api", []string{"owned"}, 0, nil)
+	s.manifest = &Manifest{Repositories: []ManifestEntry{entry}}
+	return s
+}
+
+// Get the path of a loose object in the clone
+func (s *verifySnapshot) objectPath(hash plumbing.Hash) string {
+	return filepath.Join(s.clone, ".git", "objects", hash.String()[:2], hash.String()[2:])
+}
+
+// Replace a loose object with a valid object that has different content, so it no longer matches its hash
+func (s *verifySnapshot) corruptObject(t *testing.T, hash plumbing.Hash) {
+	t.Helper()
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	fmt.Fprintf(writer, "blob 7\x00goodbye")
+	writer.Close()
+	path := s.objectPath(hash)
+	// Loose objects are read-only
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(t *testing.T, s *verifySnapshot)
+		// Problem that Verify must report, or empty if the backup is intact. README, FIRST, and SECOND are replaced with the hashes of the README.md blob and the commits.
+		want string
+	}{
+		{
+			name:   "intact",
+			damage: func(t *testing.T, s *verifySnapshot) {},
+		},
+		{
+			name: "corrupt loose object",
+			damage: func(t *testing.T, s *verifySnapshot) {
+				s.corruptObject(t, s.readme)
+			},
+			want: "object README is corrupt",
+		},
+		{
+			name: "missing object",
+			damage: func(t *testing.T, s *verifySnapshot) {
+				if err := os.Remove(s.objectPath(s.commits[0])); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "object FIRST is missing",
+		},
+		{
+			name: "ref that differs from the manifest",
+			damage: func(t *testing.T, s *verifySnapshot) {
+				setTestRef(t, s.repo, "refs/heads/main", s.commits[0])
+			},
+			want: "ref refs/heads/main points to FIRST instead of SECOND",
+		},
+		{
+			name: "extra ref",
+			damage: func(t *testing.T, s *verifySnapshot) {
+				setTestRef(t, s.repo, "refs/heads/feature", s.commits[0])
+			},
+			want: "ref refs/heads/feature isn't in the manifest",
+		},
+		{
+			name: "missing ref",
+			damage: func(t *testing.T, s *verifySnapshot) {
+				if err := s.repo.Storer.RemoveReference("refs/tags/v1"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "ref refs/tags/v1 is missing",
+		},
+		{
+			name: "failed clone",
+			damage: func(t *testing.T, s *verifySnapshot) {
+				s.manifest.Repositories[0].Status = StatusFailed
+			},
+			want: "failed to clone when it was backed up",
+		},
+		{
+			name: "missing clone",
+			damage: func(t *testing.T, s *verifySnapshot) {
+				if err := os.RemoveAll(s.clone); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "missing or not a repository",
+		},
+	}
+	for _, format := range []string{"directory", "tar.zst"} {
+		for _, test := range tests {
+			t.Run(format+"/"+test.name, func(t *testing.T) {
+				s := newVerifySnapshot(t)
+				test.damage(t, s)
+				want := strings.NewReplacer(
+					"README", s.readme.String(),
+					"FIRST", s.commits[0].String(),
+					"SECOND", s.commits[1].String(),
+				).Replace(test.want)
+				if err := writeJSON(filepath.Join(s.dir, ManifestFile), s.manifest); err != nil {
+					t.Fatal(err)
+				}
+
+				snapshot := s.dir
+				if format != "directory" {
+					snapshot = s.dir + utils.ArchiveExtensions[format]
+					if err := utils.ArchiveDir(s.dir, snapshot, format); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.RemoveAll(s.dir); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				var output bytes.Buffer
+				err := Verify(snapshot, nil, &output)
+				if want == "" {
+					if err != nil {
+						t.Errorf("got %v for an intact backup:\n%s", err, output.String())
+					}
+					return
+				}
+				if !errors.Is(err, ErrCorruptBackup) {
+					t.Fatalf("got %v, want ErrCorruptBackup", err)
+				}
+				if !strings.Contains(output.String(), want) {
+					t.Errorf("got problems:\n%s\nwant one containing %q", output.String(), want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config configures an S3-compatible bucket, such as AWS S3 or MinIO
+type S3Config struct {
+	// Endpoint is the host (and optionally port) of the server, such as `s3.amazonaws.com` or `minio.example.com:9000`
+	Endpoint string
+	Bucket   string
+	// Prefix is prepended to every key, so multiple things can share a bucket
+	Prefix          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle uses `endpoint/bucket/key` URLs instead of `bucket.endpoint/key`, which MinIO needs by default
+	PathStyle bool
+	// Insecure uses HTTP instead of HTTPS
+	Insecure bool
+}
+
+// S3 is a Storage backed by an S3-compatible bucket
+type S3 struct {
+	client *minio.Client
+	config S3Config
+}
+
+// NewS3 creates an S3 storage. If no credentials are configured, they are read from the environment (such as AWS_ACCESS_KEY_ID) or the instance's IAM role.
+func NewS3(config S3Config) (*S3, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("an endpoint and a bucket are needed for S3 storage")
+	}
+	creds := credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, "")
+	if config.AccessKeyID == "" {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.IAM{},
+		})
+	}
+	lookup := minio.BucketLookupAuto
+	if config.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       !config.Insecure,
+		Region:       config.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+	return &S3{client: client, config: config}, nil
+}
+
+func (s *S3) String() string {
+	return "s3://" + path.Join(s.config.Bucket, s.config.Prefix)
+}
+
+// Get the key of a name, which is the name under the prefix
+func (s *S3) key(name string) string {
+	return path.Join(s.config.Prefix, filepath.ToSlash(name))
+}
+
+func (s *S3) Upload(localPath string, name string) error {
+	ctx := context.Background()
+	return filepath.WalkDir(localPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Directories don't exist in S3, they are implied by keys
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relative, err := filepath.Rel(localPath, filePath)
+		if err != nil {
+			return err
+		}
+		key := s.key(filepath.Join(name, relative))
+		_, err = s.client.FPutObject(ctx, s.config.Bucket, key, filePath, minio.PutObjectOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to upload %s to %s: %w", filePath, key, err)
+		}
+		log.Debug("Uploaded file", "key", key)
+		return nil
+	})
+}
+
+func (s *S3) List() ([]string, error) {
+	prefix := ""
+	if s.config.Prefix != "" {
+		prefix = s.config.Prefix + "/"
+	}
+	// Canceled on return, so the listing stops if it fails partway
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var names []string
+	// Without Recursive, keys are grouped by the next `/`, so directories are listed as a single entry ending in `/`
+	for object := range s.client.ListObjects(ctx, s.config.Bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		names = append(names, strings.TrimSuffix(strings.TrimPrefix(object.Key, prefix), "/"))
+	}
+	return names, nil
+}
+
+func (s *S3) Remove(name string) error {
+	// Canceled once removing fails, so the listing stops instead of feeding the remover
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	key := s.key(name)
+
+	// The entry is either a single object (an archive) or every object under it (a directory)
+	objects := make(chan minio.ObjectInfo)
+	var listErr error
+	go func() {
+		defer close(objects)
+		select {
+		case objects <- minio.ObjectInfo{Key: key}:
+		case <-ctx.Done():
+			return
+		}
+		for object := range s.client.ListObjects(ctx, s.config.Bucket, minio.ListObjectsOptions{Prefix: key + "/", Recursive: true}) {
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			select {
+			case objects <- object:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	// Removing an object that doesn't exist isn't an error
+	var removeErr error
+	for result := range s.client.RemoveObjects(ctx, s.config.Bucket, objects, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil && removeErr == nil {
+			removeErr = fmt.Errorf("failed to remove %s: %w", result.ObjectName, result.Err)
+			// The results are still drained, as the remover blocks until they are read, but it finishes quickly once the listing stops
+			cancel()
+		}
+	}
+	if removeErr != nil {
+		return removeErr
+	}
+	return listErr
+}
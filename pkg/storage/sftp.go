@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/charmbracelet/log"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPConfig configures a directory on a remote host that is reachable over SSH
+type SFTPConfig struct {
+	// Host is the host and optionally port of the server, such as `backup.example.com` or `backup.example.com:2222`
+	Host string
+	User string
+	// Path is the directory backups are written to. Relative paths are relative to the user's home directory.
+	Path string
+	// KeyFile is the private key used to authenticate, such as `~/.ssh/id_ed25519`
+	KeyFile string
+	// KeyPassphrase decrypts KeyFile if it is encrypted
+	KeyPassphrase string
+	// KnownHostsFile is checked for the host's key. Hosts that aren't in it are rejected.
+	KnownHostsFile string
+}
+
+// SFTP is a Storage backed by a directory on a remote host, accessed over SFTP
+type SFTP struct {
+	clientConfig *ssh.ClientConfig
+	config       SFTPConfig
+}
+
+// NewSFTP creates an SFTP storage. The key and known hosts are read immediately, but the host is only connected to when the storage is used.
+func NewSFTP(config SFTPConfig) (*SFTP, error) {
+	if config.Host == "" || config.User == "" {
+		return nil, fmt.Errorf("a host and a user are needed for SFTP storage")
+	}
+	if config.KeyFile == "" {
+		return nil, fmt.Errorf("a key file is needed for SFTP storage")
+	}
+	if _, _, err := net.SplitHostPort(config.Host); err != nil {
+		config.Host = net.JoinHostPort(config.Host, "22")
+	}
+	if config.Path == "" {
+		config.Path = "."
+	}
+
+	key, err := os.ReadFile(expandHome(config.KeyFile))
+	if err != nil {
+		return nil, err
+	}
+	var signer ssh.Signer
+	if config.KeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(config.KeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key file %s: %w", config.KeyFile, err)
+	}
+
+	knownHostsFile := config.KnownHostsFile
+	if knownHostsFile == "" {
+		knownHostsFile = "~/.ssh/known_hosts"
+	}
+	hostKeyCallback, err := knownhosts.New(expandHome(knownHostsFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts file %s: %w", knownHostsFile, err)
+	}
+
+	return &SFTP{
+		clientConfig: &ssh.ClientConfig{
+			User:            config.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+		},
+		config: config,
+	}, nil
+}
+
+func (s *SFTP) String() string {
+	return fmt.Sprintf("sftp://%s@%s/%s", s.config.User, s.config.Host, s.config.Path)
+}
+
+// Connect to the host, run do with an SFTP client, and disconnect
+func (s *SFTP) withClient(do func(client *sftp.Client) error) error {
+	conn, err := ssh.Dial("tcp", s.config.Host, s.clientConfig)
+	if err != nil {
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return fmt.Errorf("%s isn't in the known hosts file; add it with `ssh-keyscan`: %w", s.config.Host, err)
+		}
+		return err
+	}
+	defer conn.Close()
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return do(client)
+}
+
+// Get the remote path of a name, which is the name under Path
+func (s *SFTP) remotePath(name string) string {
+	return path.Join(s.config.Path, filepath.ToSlash(name))
+}
+
+func (s *SFTP) Upload(localPath string, name string) error {
+	return s.withClient(func(client *sftp.Client) error {
+		return filepath.WalkDir(localPath, func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			relative, err := filepath.Rel(localPath, filePath)
+			if err != nil {
+				return err
+			}
+			remote := s.remotePath(filepath.Join(name, relative))
+			if entry.IsDir() {
+				return client.MkdirAll(remote)
+			}
+			if !entry.Type().IsRegular() {
+				return nil
+			}
+			// Make sure the parent exists when a single file, such as an archive, is uploaded
+			err = client.MkdirAll(path.Dir(remote))
+			if err != nil {
+				return err
+			}
+			err = uploadFile(client, filePath, remote)
+			if err != nil {
+				return fmt.Errorf("failed to upload %s to %s: %w", filePath, remote, err)
+			}
+			log.Debug("Uploaded file", "path", remote)
+			return nil
+		})
+	})
+}
+
+// Copy a local file to the remote path.
+// The file is written next to the remote path and renamed once it is complete, so an interrupted upload doesn't look like a complete file.
+func uploadFile(client *sftp.Client, localPath string, remote string) error {
+	local, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	partial := remote + ".part"
+	file, err := client.Create(partial)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, local)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		client.Remove(partial)
+		return err
+	}
+	// Unlike Rename, PosixRename overwrites an existing file, but it needs an OpenSSH extension
+	err = client.PosixRename(partial, remote)
+	if err == nil {
+		return nil
+	}
+	// Rename fails if remote exists, so move the existing file aside and only delete it once the new one is in place
+	previous := remote + ".old"
+	_, statErr := client.Stat(remote)
+	if statErr == nil {
+		// Left behind if a previous upload was interrupted
+		client.Remove(previous)
+		err = client.Rename(remote, previous)
+		if err != nil {
+			client.Remove(partial)
+			return err
+		}
+	}
+	err = client.Rename(partial, remote)
+	if err != nil {
+		client.Remove(partial)
+		if statErr == nil {
+			client.Rename(previous, remote)
+		}
+		return err
+	}
+	if statErr == nil {
+		if err := client.Remove(previous); err != nil {
+			// The upload itself succeeded
+			log.Warn("Failed to remove the previous version of an uploaded file", "path", previous, "err", err)
+		}
+	}
+	return nil
+}
+
+func (s *SFTP) List() ([]string, error) {
+	var names []string
+	err := s.withClient(func(client *sftp.Client) error {
+		entries, err := client.ReadDir(s.config.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Nothing has been uploaded yet
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return nil
+	})
+	return names, err
+}
+
+func (s *SFTP) Remove(name string) error {
+	return s.withClient(func(client *sftp.Client) error {
+		return client.RemoveAll(s.remotePath(name))
+	})
+}
+
+// Replace a leading `~/` with the user's home directory
+func expandHome(p string) string {
+	if len(p) < 2 || p[:2] != "~/" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[2:])
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// Storage is a destination backups are copied to after they are written to the local output directory.
+// Names are relative to the root of the storage (such as a bucket prefix), and each backup is an entry at the root, either a directory or an archive.
+type Storage interface {
+	// Upload copies a local file or directory, and everything in it, to name
+	Upload(localPath string, name string) error
+	// List returns the names of the entries at the root of the storage
+	List() ([]string, error)
+	// Remove deletes an entry at the root of the storage and everything under it
+	Remove(name string) error
+	// String describes the storage for logs, such as `s3://bucket/prefix`
+	String() string
+}
+
+// Config selects and configures a Storage
+type Config struct {
+	// Type can be `local` (only keep backups in the output directory), `s3`, or `sftp`
+	Type string
+	S3   S3Config
+	SFTP SFTPConfig
+	// KeepLocal keeps the backup in the output directory after it was uploaded
+	KeepLocal bool
+}
+
+// New creates the Storage selected by the config. For `local`, or an empty type, nil is returned as backups don't need to be copied anywhere.
+func New(config Config) (Storage, error) {
+	switch config.Type {
+	case "", "local":
+		return nil, nil
+	case "s3":
+		return NewS3(config.S3)
+	case "sftp":
+		return NewSFTP(config.SFTP)
+	default:
+		return nil, fmt.Errorf("invalid storage type: %s; must be one of `local`, `s3`, or `sftp`", config.Type)
+	}
+}
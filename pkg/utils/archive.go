@@ -0,0 +1,333 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/charmbracelet/log"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported archive formats and their file extensions
+var ArchiveExtensions = map[string]string{
+	"tar.gz":  ".tar.gz",
+	"tar.zst": ".tar.zst",
+}
+
+// TrimArchiveExtension removes a known archive extension, and the extension of encrypted archives, from a file name.
+// found is false if the name doesn't end in one.
+func TrimArchiveExtension(name string) (trimmed string, found bool) {
+	name = strings.TrimSuffix(name, EncryptedExtension)
+	for _, extension := range ArchiveExtensions {
+		if strings.HasSuffix(name, extension) {
+			return strings.TrimSuffix(name, extension), true
+		}
+	}
+	return name, false
+}
+
+// ArchiveDir writes the contents of a directory to a compressed tar archive at dest.
+// Paths in the archive are relative to the directory. If the directory has a `manifest.json`, it is written first so it can be read without going through the entire archive.
+// format is the key of a format in ArchiveExtensions.
+// If any recipients are passed, the archive is encrypted to them as it is written, so the unencrypted archive never lands on disk.
+func ArchiveDir(dir string, dest string, format string, recipients ...age.Recipient) (err error) {
+	file, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		// Don't leave a truncated archive behind
+		if err != nil {
+			os.Remove(dest)
+		}
+	}()
+
+	var output io.Writer = file
+	if len(recipients) > 0 {
+		// Assigned rather than declared so closing it sets the returned error
+		var encryptor io.WriteCloser
+		encryptor, err = age.Encrypt(file, recipients...)
+		if err != nil {
+			return err
+		}
+		// The encryptor has to be closed to write the last chunk, after the compressor is closed
+		defer func() {
+			if closeErr := encryptor.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		output = encryptor
+	}
+
+	var compressor io.WriteCloser
+	switch format {
+	case "tar.gz":
+		compressor = gzip.NewWriter(output)
+	case "tar.zst":
+		compressor, err = zstd.NewWriter(output)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid archive format: %s; must be one of `tar.gz` or `tar.zst`", format)
+	}
+	// Closing the compressor flushes it and stops the zstd encoder's goroutines, so it has to happen on every path
+	compressorClosed := false
+	defer func() {
+		if !compressorClosed {
+			compressor.Close()
+		}
+	}()
+	tarWriter := tar.NewWriter(compressor)
+
+	manifest := filepath.Join(dir, "manifest.json")
+	if _, err := os.Stat(manifest); err == nil {
+		err = addToArchive(tarWriter, dir, manifest)
+		if err != nil {
+			return err
+		}
+	}
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir || path == manifest {
+			return nil
+		}
+		return addToArchive(tarWriter, dir, path)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return err
+	}
+	compressorClosed = true
+	return compressor.Close()
+}
+
+// Write a file, directory, or symlink to a tar archive with a path relative to root
+func addToArchive(tarWriter *tar.Writer, root string, path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	link := ""
+	if info.Mode()&fs.ModeSymlink != 0 {
+		link, err = os.Readlink(path)
+		if err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	relative, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(relative)
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	err = tarWriter.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(tarWriter, file)
+	return err
+}
+
+// OpenArchive opens a compressed tar archive created by ArchiveDir, detecting the format from the file extension.
+// Encrypted archives (ending in EncryptedExtension) are decrypted with identities.
+// The returned function closes the archive.
+func OpenArchive(path string, identities ...age.Identity) (*tar.Reader, func() error, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var input io.Reader = file
+	if strings.HasSuffix(path, EncryptedExtension) {
+		if len(identities) == 0 {
+			file.Close()
+			return nil, nil, fmt.Errorf("%s is encrypted; an identity is needed to decrypt it", path)
+		}
+		input, err = age.Decrypt(file, identities...)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		path = strings.TrimSuffix(path, EncryptedExtension)
+	}
+	switch {
+	case strings.HasSuffix(path, ArchiveExtensions["tar.gz"]):
+		decompressed, err := gzip.NewReader(input)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return tar.NewReader(decompressed), file.Close, nil
+	case strings.HasSuffix(path, ArchiveExtensions["tar.zst"]):
+		decompressed, err := zstd.NewReader(input)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return tar.NewReader(decompressed), func() error {
+			// Stops the decoder's goroutines
+			decompressed.Close()
+			return file.Close()
+		}, nil
+	default:
+		file.Close()
+		return nil, nil, fmt.Errorf("unknown archive format: %s", path)
+	}
+}
+
+// ExtractArchive extracts a compressed tar archive created by ArchiveDir into dest, decrypting it with identities if it is encrypted.
+// Entries are never written outside dest: paths that escape it, or that go through a symlink, are refused, and symlinks pointing outside dest are skipped.
+func ExtractArchive(path string, dest string, identities ...age.Identity) error {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	tarReader, closeArchive, err := OpenArchive(path, identities...)
+	if err != nil {
+		return err
+	}
+	defer closeArchive()
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := archiveTarget(dest, header.Name)
+		if err != nil {
+			return err
+		}
+		// A symlink extracted earlier could otherwise redirect this entry anywhere, such as `link/file` with link pointing to /etc
+		err = checkNoSymlinks(dest, target)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeSymlink:
+			// Working trees can have symlinks to anything, but following one out of dest later shouldn't be possible
+			resolved := header.Linkname
+			if !filepath.IsAbs(resolved) {
+				resolved = filepath.Join(filepath.Dir(target), filepath.FromSlash(resolved))
+			}
+			if !withinDir(dest, filepath.Clean(resolved)) {
+				log.Warn("Skipping symlink in archive that points outside of it", "path", header.Name, "target", header.Linkname)
+				continue
+			}
+			err = os.MkdirAll(filepath.Dir(target), 0755)
+			if err == nil {
+				err = os.Symlink(header.Linkname, target)
+			}
+		case tar.TypeLink:
+			// Archives created by other tools, such as GNU tar, store files with multiple links once
+			var linkTarget string
+			linkTarget, err = archiveTarget(dest, header.Linkname)
+			if err == nil {
+				err = checkNoSymlinks(dest, linkTarget)
+			}
+			if err == nil {
+				err = os.MkdirAll(filepath.Dir(target), 0755)
+			}
+			if err == nil {
+				err = os.Link(linkTarget, target)
+			}
+		case tar.TypeReg:
+			err = extractFile(tarReader, target, header.FileInfo().Mode().Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Get the path an entry of an archive is extracted to, refusing paths that would escape dest
+func archiveTarget(dest string, name string) (string, error) {
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	if !withinDir(dest, target) {
+		return "", fmt.Errorf("invalid path in archive: %s", name)
+	}
+	return target, nil
+}
+
+// Check if the cleaned path is dir or inside it.
+// The root of archives created by tools such as `tar -C dir .` is `./`, which is dir itself.
+func withinDir(dir string, path string) bool {
+	dir = filepath.Clean(dir)
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// Check that neither target nor any directory between dest and target is a symlink, so writing to target can't end up outside dest.
+// Parts of the path that don't exist yet are fine, as they are created as directories.
+func checkNoSymlinks(dest string, target string) error {
+	relative, err := filepath.Rel(dest, target)
+	if err != nil || relative == "." {
+		return err
+	}
+	path := dest
+	for _, part := range strings.Split(relative, string(os.PathSeparator)) {
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			rel, _ := filepath.Rel(dest, path)
+			return fmt.Errorf("invalid path in archive: %s goes through the symlink %s", filepath.ToSlash(relative), filepath.ToSlash(rel))
+		}
+	}
+	return nil
+}
+
+func extractFile(reader io.Reader, target string, mode fs.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// Write a tar.gz archive with the given entries, in order
+func writeTestArchive(t *testing.T, headers []*tar.Header) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.tar.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	compressor := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(compressor)
+	for _, header := range headers {
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(header.Name))
+			header.Mode = 0644
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tarWriter.Write([]byte(header.Name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := compressor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractArchiveRoundTrip(t *testing.T) {
+	source := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(source, "owner", "repo", "objects"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "manifest.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "owner", "repo", "objects", "pack"), []byte("pack"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("objects/pack", filepath.Join(source, "owner", "repo", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for format := range ArchiveExtensions {
+		for _, encrypted := range []bool{false, true} {
+			name := format
+			archive := filepath.Join(t.TempDir(), "backup"+ArchiveExtensions[format])
+			var recipients []age.Recipient
+			if encrypted {
+				name += " encrypted"
+				archive += EncryptedExtension
+				recipients = append(recipients, identity.Recipient())
+			}
+			t.Run(name, func(t *testing.T) {
+				if err := ArchiveDir(source, archive, format, recipients...); err != nil {
+					t.Fatal(err)
+				}
+				dest := t.TempDir()
+				if err := ExtractArchive(archive, dest, identity); err != nil {
+					t.Fatal(err)
+				}
+				contents, err := os.ReadFile(filepath.Join(dest, "owner", "repo", "link"))
+				if err != nil || string(contents) != "pack" {
+					t.Errorf("got %q, %v through the symlink, want %q", contents, err, "pack")
+				}
+			})
+		}
+	}
+}
+
+func TestExtractArchiveStaysInDest(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+		// Whether extracting fails, rather than skipping the symlink and extracting the rest into dest
+		fails bool
+	}{
+		{
+			name:    "parent directory",
+			headers: []*tar.Header{{Name: "../escaped", Typeflag: tar.TypeReg}},
+			fails:   true,
+		},
+		{
+			name: "file through an absolute symlink",
+			headers: []*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "OUTSIDE"},
+				{Name: "link/escaped", Typeflag: tar.TypeReg},
+			},
+		},
+		{
+			name: "file through a relative symlink",
+			headers: []*tar.Header{
+				{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+				{Name: "dir/link/escaped", Typeflag: tar.TypeReg},
+			},
+		},
+		{
+			name: "file through a symlink inside dest",
+			headers: []*tar.Header{
+				{Name: "dir/", Typeflag: tar.TypeDir},
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir"},
+				{Name: "link/file", Typeflag: tar.TypeReg},
+			},
+			fails: true,
+		},
+		{
+			name: "overwriting a symlink",
+			headers: []*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "file"},
+				{Name: "link", Typeflag: tar.TypeReg},
+			},
+			fails: true,
+		},
+		{
+			name: "hard link through a symlink",
+			headers: []*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "OUTSIDE"},
+				{Name: "hardlink", Typeflag: tar.TypeLink, Linkname: "link/escaped"},
+			},
+			fails: true,
+		},
+		{
+			name: "hard link outside dest",
+			headers: []*tar.Header{
+				{Name: "hardlink", Typeflag: tar.TypeLink, Linkname: "../escaped"},
+			},
+			fails: true,
+		},
+		{
+			name:    "absolute symlink is skipped",
+			headers: []*tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "OUTSIDE"}},
+		},
+		{
+			name:    "relative symlink out of dest is skipped",
+			headers: []*tar.Header{{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "../../escaped"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outside := t.TempDir()
+			if err := os.WriteFile(filepath.Join(outside, "escaped"), []byte("original"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			for _, header := range test.headers {
+				header.Linkname = strings.ReplaceAll(header.Linkname, "OUTSIDE", outside)
+			}
+			archive := writeTestArchive(t, test.headers)
+			// Nested so that `../escaped` and `../..` from dest land in a directory the test owns
+			dest := filepath.Join(outside, "dest")
+			err := ExtractArchive(archive, dest)
+			if test.fails && err == nil {
+				t.Error("expected an error")
+			} else if !test.fails && err != nil {
+				t.Error(err)
+			}
+
+			contents, err := os.ReadFile(filepath.Join(outside, "escaped"))
+			if err != nil || string(contents) != "original" {
+				t.Errorf("file outside dest was modified: %q, %v", contents, err)
+			}
+			for _, name := range []string{"link", "dir/link"} {
+				path := filepath.Join(dest, name)
+				target, err := os.Readlink(path)
+				if err != nil {
+					continue
+				}
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(filepath.Dir(path), target)
+				}
+				if !withinDir(dest, filepath.Clean(target)) {
+					t.Errorf("symlink %s pointing outside dest was created", name)
+				}
+			}
+		})
+	}
+}
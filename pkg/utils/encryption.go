@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+)
+
+// The extension appended to archives that are encrypted with age
+const EncryptedExtension = ".age"
+
+// ParseRecipients parses age public keys (`age1...`) and SSH public keys (`ssh-ed25519 ...` or `ssh-rsa ...`) that archives are encrypted to.
+// If file isn't empty, recipients are read from it as well, one per line. Empty lines and lines starting with `#` are ignored.
+func ParseRecipients(recipients []string, file string) ([]age.Recipient, error) {
+	lines := recipients
+	if file != "" {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, strings.Split(string(contents), "\n")...)
+	}
+
+	var parsed []age.Recipient
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var recipient age.Recipient
+		var err error
+		if strings.HasPrefix(line, "ssh-") {
+			recipient, err = agessh.ParseRecipient(line)
+		} else {
+			recipient, err = age.ParseX25519Recipient(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", line, err)
+		}
+		parsed = append(parsed, recipient)
+	}
+	return parsed, nil
+}
+
+// ParseIdentitiesFile reads the private keys used to decrypt archives from a file.
+// The file can either contain age secret keys (`AGE-SECRET-KEY-1...`), one per line, or an unencrypted SSH private key.
+func ParseIdentitiesFile(path string) ([]age.Identity, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(string(contents), "PRIVATE KEY") {
+		identity, err := agessh.ParseIdentity(contents)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Identity{identity}, nil
+	}
+	return age.ParseIdentities(strings.NewReader(string(contents)))
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/charmbracelet/log"
+)
+
+// LinkTree recreates the directory src at dst without copying the data of files where possible.
+// Files that shouldLink returns true for (given their slash-separated path relative to src) are hard linked, so they must never be modified in place.
+// Every other file is cloned with CloneFile, so it can be modified without affecting src.
+// If a file can't be hard linked, such as when src and dst are on different filesystems, it is cloned instead.
+func LinkTree(src string, dst string, shouldLink func(relative string) bool) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relative)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !entry.Type().IsRegular():
+			return nil
+		}
+
+		if shouldLink(filepath.ToSlash(relative)) {
+			err := os.Link(path, target)
+			if err == nil {
+				return nil
+			}
+			log.Debug("Failed to hard link file, cloning it instead", "path", path, "err", err)
+		}
+		return CloneFile(path, target, info.Mode().Perm())
+	})
+}
+
+// CloneFile copies src to dst, which must not exist.
+// On filesystems that support it, such as Btrfs or XFS, the copy is a copy-on-write reflink, so the data is shared until either file is modified.
+func CloneFile(src string, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if reflink(in, out) == nil {
+		return out.Close()
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
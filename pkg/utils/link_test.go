@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Check if two paths are the same file, such as hard links to it
+func sameFile(t *testing.T, a string, b string) bool {
+	t.Helper()
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return os.SameFile(aInfo, bInfo)
+}
+
+func TestLinkTree(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"shared/a":       "a",
+		"shared/deep/b":  "b",
+		"mutable":        "original",
+		"nested/mutable": "original",
+	}
+	for name, contents := range files {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("shared/a", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	err := LinkTree(src, dst, func(relative string) bool {
+		return strings.HasPrefix(relative, "shared/")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, contents := range files {
+		got, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != contents {
+			t.Errorf("%s: got %q, want %q", name, got, contents)
+		}
+		linked := sameFile(t, filepath.Join(src, name), filepath.Join(dst, name))
+		if want := strings.HasPrefix(name, "shared/"); linked != want {
+			t.Errorf("%s: hard linked: %t, want %t", name, linked, want)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "link")); err != nil || link != "shared/a" {
+		t.Errorf("got symlink to %q (%v), want %q", link, err, "shared/a")
+	}
+
+	// Files that were copied can be modified without affecting src
+	for _, name := range []string{"mutable", "nested/mutable"} {
+		if err := os.WriteFile(filepath.Join(dst, name), []byte("modified"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(filepath.Join(src, name)); string(got) != "original" {
+			t.Errorf("%s in src changed to %q after modifying it in dst", name, got)
+		}
+	}
+}
+
+func TestCloneFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "dst")
+	if err := CloneFile(src, dst, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(dst); string(got) != "contents" {
+		t.Errorf("got %q, want %q", got, "contents")
+	}
+	if sameFile(t, src, dst) {
+		t.Error("the clone is the same file as the original")
+	}
+	// The destination must not exist
+	if err := CloneFile(src, dst, 0600); err == nil {
+		t.Error("expected an error when the destination exists")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package utils
+
+import (
+	"errors"
+	"os"
+)
+
+// Reflinks are only implemented on Linux, so files are always copied elsewhere
+func reflink(src *os.File, dst *os.File) error {
+	return errors.ErrUnsupported
+}
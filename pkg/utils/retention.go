@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// RetentionPolicy decides which timestamped backups are kept, like a grandfather-father-son rotation.
+// A backup is kept if any rule keeps it. For the hourly, daily, weekly, monthly, and yearly rules, the most recent backup of each of the most recent n periods that have a backup is kept.
+// A policy without any rules keeps every backup.
+type RetentionPolicy struct {
+	// KeepLast keeps the most recent n backups
+	KeepLast    int
+	KeepHourly  int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	KeepYearly  int
+	// KeepWithin keeps every backup made within this duration of the most recent backup
+	KeepWithin time.Duration
+}
+
+// RetentionDecision is whether a backup is kept by a RetentionPolicy, and which rules kept it
+type RetentionDecision struct {
+	Name    string
+	Time    time.Time
+	Keep    bool
+	Reasons []string
+}
+
+// A rule that keeps the most recent backup of each period. Backups in the same period have the same key.
+type retentionRule struct {
+	name  string
+	count int
+	key   func(t time.Time) string
+}
+
+func (p RetentionPolicy) rules() []retentionRule {
+	return []retentionRule{
+		// Every backup is its own period
+		{"last", p.KeepLast, func(t time.Time) string { return t.String() }},
+		{"hourly", p.KeepHourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{"daily", p.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", p.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+		{"monthly", p.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{"yearly", p.KeepYearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+}
+
+// IsEmpty reports whether the policy has no rules, in which case every backup is kept
+func (p RetentionPolicy) IsEmpty() bool {
+	return p == RetentionPolicy{}
+}
+
+// Apply decides which backups to keep. Names are backup directories or archives named after their timestamp in TimeFormat.
+// Names that aren't timestamps are left out, as they aren't backups that can be rotated.
+// Decisions are returned from the most recent backup to the oldest.
+func (p RetentionPolicy) Apply(names []string) []RetentionDecision {
+	var decisions []RetentionDecision
+	for _, name := range names {
+		trimmed, _ := TrimArchiveExtension(name)
+		t, err := time.Parse(TimeFormat, trimmed)
+		if err != nil {
+			continue
+		}
+		decisions = append(decisions, RetentionDecision{Name: name, Time: t})
+	}
+	slices.SortStableFunc(decisions, func(a, b RetentionDecision) int {
+		return b.Time.Compare(a.Time)
+	})
+	if len(decisions) == 0 {
+		return decisions
+	}
+
+	if p.IsEmpty() {
+		for i := range decisions {
+			decisions[i].Keep = true
+			decisions[i].Reasons = []string{"no policy"}
+		}
+		return decisions
+	}
+
+	for _, rule := range p.rules() {
+		if rule.count <= 0 {
+			continue
+		}
+		kept := 0
+		lastKey := ""
+		for i := range decisions {
+			if kept >= rule.count {
+				break
+			}
+			key := rule.key(decisions[i].Time)
+			if key == lastKey {
+				continue
+			}
+			lastKey = key
+			kept++
+			decisions[i].Keep = true
+			decisions[i].Reasons = append(decisions[i].Reasons, rule.name)
+		}
+	}
+
+	if p.KeepWithin > 0 {
+		cutoff := decisions[0].Time.Add(-p.KeepWithin)
+		for i := range decisions {
+			if !decisions[i].Time.Before(cutoff) {
+				decisions[i].Keep = true
+				decisions[i].Reasons = append(decisions[i].Reasons, "within")
+			}
+		}
+	}
+	return decisions
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		names  []string
+		// Kept backups, most recent first, with the rules that kept them
+		want []string
+	}{
+		{
+			name:   "no policy keeps everything",
+			policy: RetentionPolicy{},
+			names:  []string{"2024-01-01-00-00-00", "2024-01-02-00-00-00"},
+			want:   []string{"2024-01-02-00-00-00 no policy", "2024-01-01-00-00-00 no policy"},
+		},
+		{
+			name:   "names that aren't timestamps are left out",
+			policy: RetentionPolicy{KeepLast: 1},
+			names:  []string{"notes.txt", "2024-01-01-00-00-00", "manifest.json", "2024-13-01-00-00-00"},
+			want:   []string{"2024-01-01-00-00-00 last"},
+		},
+		{
+			name:   "archives are backups",
+			policy: RetentionPolicy{KeepLast: 2},
+			names:  []string{"2024-01-01-00-00-00.tar.gz", "2024-01-02-00-00-00.tar.zst.age", "2024-01-03-00-00-00.tar.zst"},
+			want:   []string{"2024-01-03-00-00-00.tar.zst last", "2024-01-02-00-00-00.tar.zst.age last"},
+		},
+		{
+			name:   "last",
+			policy: RetentionPolicy{KeepLast: 2},
+			names:  []string{"2024-01-01-00-00-00", "2024-01-01-01-00-00", "2024-01-01-02-00-00", "2024-01-01-03-00-00"},
+			want:   []string{"2024-01-01-03-00-00 last", "2024-01-01-02-00-00 last"},
+		},
+		{
+			name:   "hourly keeps the most recent backup of each hour",
+			policy: RetentionPolicy{KeepHourly: 2},
+			names:  []string{"2024-01-01-10-05-00", "2024-01-01-10-55-00", "2024-01-01-11-30-00", "2024-01-01-11-45-00", "2024-01-01-09-00-00"},
+			want:   []string{"2024-01-01-11-45-00 hourly", "2024-01-01-10-55-00 hourly"},
+		},
+		{
+			name:   "daily skips days without a backup",
+			policy: RetentionPolicy{KeepDaily: 3},
+			names:  []string{"2024-01-01-02-00-00", "2024-01-03-02-00-00", "2024-01-03-14-00-00", "2024-01-07-02-00-00", "2024-01-08-02-00-00"},
+			want:   []string{"2024-01-08-02-00-00 daily", "2024-01-07-02-00-00 daily", "2024-01-03-14-00-00 daily"},
+		},
+		{
+			name:   "weekly uses ISO weeks, which start on Monday",
+			policy: RetentionPolicy{KeepWeekly: 2},
+			// Sunday the 7th is in the same week as Monday the 1st
+			names: []string{"2024-01-01-00-00-00", "2024-01-07-00-00-00", "2024-01-08-00-00-00", "2024-01-14-00-00-00"},
+			want:  []string{"2024-01-14-00-00-00 weekly", "2024-01-07-00-00-00 weekly"},
+		},
+		{
+			name:   "weekly across the end of a year",
+			policy: RetentionPolicy{KeepWeekly: 2},
+			// 2024-12-30 is in week 1 of 2025
+			names: []string{"2024-12-29-00-00-00", "2024-12-30-00-00-00", "2025-01-05-00-00-00"},
+			want:  []string{"2025-01-05-00-00-00 weekly", "2024-12-29-00-00-00 weekly"},
+		},
+		{
+			name:   "monthly and yearly",
+			policy: RetentionPolicy{KeepMonthly: 2, KeepYearly: 3},
+			names:  []string{"2022-06-01-00-00-00", "2023-11-30-00-00-00", "2023-12-01-00-00-00", "2023-12-31-00-00-00", "2024-01-15-00-00-00"},
+			want:   []string{"2024-01-15-00-00-00 monthly yearly", "2023-12-31-00-00-00 monthly yearly", "2022-06-01-00-00-00 yearly"},
+		},
+		{
+			name:   "rules are combined",
+			policy: RetentionPolicy{KeepLast: 1, KeepDaily: 2, KeepMonthly: 2},
+			names:  []string{"2024-01-31-00-00-00", "2024-02-01-00-00-00", "2024-02-02-00-00-00", "2024-02-02-12-00-00"},
+			want:   []string{"2024-02-02-12-00-00 last daily monthly", "2024-02-01-00-00-00 daily", "2024-01-31-00-00-00 monthly"},
+		},
+		{
+			name:   "within is relative to the most recent backup",
+			policy: RetentionPolicy{KeepWithin: 48 * time.Hour},
+			names:  []string{"2024-01-01-00-00-00", "2024-01-08-00-00-00", "2024-01-09-00-00-00", "2024-01-10-00-00-00"},
+			want:   []string{"2024-01-10-00-00-00 within", "2024-01-09-00-00-00 within", "2024-01-08-00-00-00 within"},
+		},
+		{
+			name:   "nothing to keep",
+			policy: RetentionPolicy{KeepDaily: 7},
+			names:  []string{"backup", "failures.json"},
+			want:   nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decisions := test.policy.Apply(test.names)
+			var got []string
+			for i, decision := range decisions {
+				if i > 0 && decision.Time.After(decisions[i-1].Time) {
+					t.Errorf("decisions aren't sorted from the most recent: %s after %s", decision.Name, decisions[i-1].Name)
+				}
+				if decision.Keep {
+					got = append(got, decision.Name+" "+strings.Join(decision.Reasons, " "))
+				} else if len(decision.Reasons) > 0 {
+					t.Errorf("%s isn't kept but has reasons %v", decision.Name, decision.Reasons)
+				}
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRollingDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"2020-01-01-00-00-00", "2020-01-02-00-00-00", "2020-01-03-00-00-00", "not-a-backup"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2020-01-02-12-00-00.tar.zst"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next backup counts as the most recent one, so only one existing backup is kept
+	next, err := RollingDir(dir, RetentionPolicy{KeepLast: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	want := []string{"2020-01-03-00-00-00", filepath.Base(next), "not-a-backup"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
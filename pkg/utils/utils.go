@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"io/fs"
 	"os"
 	"path/filepath"
 	"slices"
@@ -41,62 +42,100 @@ func EmptyDir(pathToDir string) error {
 	return nil
 }
 
-// RollingDir takes a directory path and a number of backups to keep. It is intended to be run before a backup is started.
-// It will remove all but the most recent n-1 backups (directories) in the directory. The backup directories are expected to be named in the format `backup-<timestamp>`.
-// After making sure the directory has the correct number of backups, it will return the path to what the next backup directory should be named.
-func RollingDir(pathToDir string, maxBackups int) (string, error) {
-	// https://stackoverflow.com/questions/42217308/go-time-format-how-to-understand-meaning-of-2006-01-02-layout/42217483#42217483
-	// 2006: year; 01: month; 02: day; 15: hour; 04: minute; 05: second
-	timeFormat := "2006-01-02-15-04-05"
-
-	// Get all directories in the path
-	dirs := []string{}
+// TimeFormat is the format of the timestamps backups are named after
+// https://stackoverflow.com/questions/42217308/go-time-format-how-to-understand-meaning-of-2006-01-02-layout/42217483#42217483
+// 2006: year; 01: month; 02: day; 15: hour; 04: minute; 05: second
+const TimeFormat = "2006-01-02-15-04-05"
 
+// RollingDir takes a directory path and a retention policy. It is intended to be run before a backup is started.
+// It will remove the backups (directories or archives) in the directory that the policy doesn't keep, counting the backup that is about to start as the most recent one. The backup directories are expected to be named after their timestamp in TimeFormat.
+// After making sure the directory only has the backups the policy keeps, it will return the path to what the next backup directory should be named.
+func RollingDir(pathToDir string, policy RetentionPolicy) (string, error) {
 	// Whilst the directory is created when backing up (clone or fetch), that's later. If the directory doesn't exist, os.ReadDir error. Thus, ensure it, and any parent directories, exist.
 	err := os.MkdirAll(pathToDir, 0644)
 	if err != nil {
 		return "", err
 	}
 
-	filesAndDirs, err := os.ReadDir(pathToDir)
+	dirs, err := ListBackups(pathToDir)
 	if err != nil {
 		return "", err
 	}
-
-	for _, fileAndDir := range filesAndDirs {
-		if fileAndDir.IsDir() {
-			dirs = append(dirs, fileAndDir.Name())
-		} else {
-			log.Warn("Found a file in the backup directory, ignoring", "file", fileAndDir.Name())
-		}
-	}
-
 	log.Debug("Found directories", "directories", dirs)
 
-	overLimit := (len(dirs) - maxBackups) + 1
-
-	for i := 0; i < overLimit; i++ {
-		err := RemoveOldestDir(&dirs, pathToDir, timeFormat)
+	next := time.Now().Format(TimeFormat)
+	for _, decision := range policy.Apply(append(dirs, next)) {
+		if decision.Keep {
+			continue
+		}
+		toRemove := filepath.Join(pathToDir, decision.Name)
+		err := os.RemoveAll(toRemove)
 		if err != nil {
 			return "", err
 		}
+		log.Info("Removed backup not kept by the retention policy", "path", toRemove)
 	}
 
-	// for now, just return the CreateTimeBasedDir even if there are too many directories
-	dirPath, err := CreateTimeBasedDir(pathToDir, timeFormat)
+	dirPath := filepath.Join(pathToDir, next)
+	err = os.MkdirAll(dirPath, 0644)
 	if err != nil {
 		return "", err
 	}
-
 	return dirPath, nil
+}
 
+// ListBackups returns the names of the backups (directories or archives) in a directory
+func ListBackups(pathToDir string) ([]string, error) {
+	dirs := []string{}
+	filesAndDirs, err := os.ReadDir(pathToDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fileAndDir := range filesAndDirs {
+		if fileAndDir.IsDir() {
+			dirs = append(dirs, fileAndDir.Name())
+		} else if _, isArchive := TrimArchiveExtension(fileAndDir.Name()); isArchive {
+			// Archived backups count as backups as well
+			dirs = append(dirs, fileAndDir.Name())
+		} else {
+			log.Warn("Found a file in the backup directory, ignoring", "file", fileAndDir.Name())
+		}
+	}
+	return dirs, nil
 }
 
-func RemoveOldestDir(dirNames *[]string, parentDir string, timeFormat string) error {
-	// Sort the directories by time
-	// https://stackoverflow.com/questions/23121026/how-to-sort-by-time-time/77235904#77235904
+// LatestDir returns the path of the most recent backup directory in parentDir other than exclude, or an empty string if there is none.
+// Archived backups are ignored, as they can't be reused.
+func LatestDir(parentDir string, exclude string) (string, error) {
+	entries, err := os.ReadDir(parentDir)
+	if err != nil {
+		return "", err
+	}
+	dirs := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == filepath.Base(exclude) {
+			continue
+		}
+		if _, err := time.Parse(TimeFormat, entry.Name()); err != nil {
+			continue
+		}
+		dirs = append(dirs, entry.Name())
+	}
+	if len(dirs) == 0 {
+		return "", nil
+	}
+	SortBackups(dirs, TimeFormat)
+	return filepath.Join(parentDir, dirs[len(dirs)-1]), nil
+}
 
+// SortBackups sorts backup names (directories or archives named after a timestamp) from oldest to newest
+func SortBackups(names []string, timeFormat string) {
+	// https://stackoverflow.com/questions/23121026/how-to-sort-by-time-time/77235904#77235904
 	timestampSort := func(i, j string) int {
+		// Archived backups are named after the directory they were created from
+		i, _ = TrimArchiveExtension(i)
+		j, _ = TrimArchiveExtension(j)
 		timeI, err := time.Parse(timeFormat, i)
 		if err != nil {
 			return 0
@@ -108,17 +147,7 @@ func RemoveOldestDir(dirNames *[]string, parentDir string, timeFormat string) er
 
 		return timeI.Compare(timeJ)
 	}
-	slices.SortFunc(*dirNames, timestampSort)
-
-	// Remove the oldest directory
-	toRemove := filepath.Join(parentDir, (*dirNames)[0])
-	err := os.RemoveAll(toRemove)
-	log.Info("Removed oldest backup", "path", toRemove)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	slices.SortFunc(names, timestampSort)
 }
 
 // Function to make a subdirectory in the parent directory with the current time
@@ -142,3 +171,22 @@ func IsDirectory(path string) (bool, error) {
 	}
 	return fileInfo.IsDir(), err
 }
+
+// DirSize returns the total size in bytes of the regular files in a directory and its subdirectories.
+func DirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}